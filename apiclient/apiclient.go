@@ -1,40 +1,204 @@
+// Package apiclient provides a shared HTTP retry policy used by every
+// package that calls a third-party API (todoist, onedrive).
 package apiclient
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// retryObserver, if set via SetRetryObserver, is called once for every
+// retry DoWithRetries makes, across every caller in the process. This
+// avoids threading a metrics dependency through every package that builds a
+// RetryConfig (todoist, onedrive).
+var retryObserver = func() {}
+
+// SetRetryObserver registers f to be called once per retry attempt made by
+// DoWithRetries. Intended to be called once, from main, to wire in metrics
+// collection; a nil f disables the observer.
+func SetRetryObserver(f func()) {
+	if f == nil {
+		f = func() {}
+	}
+	retryObserver = f
+}
+
+// RetryConfig controls how DoWithRetries retries a failed request.
 type RetryConfig struct {
-	IntervalBetweenRetries time.Duration
-	MaxRetries             int
+	// MaxRetries is the number of additional attempts made after the
+	// first one fails.
+	MaxRetries int
+
+	// BaseDelay is the starting point for the exponential backoff. Actual
+	// sleep time is jittered, so most sleeps will be shorter than this on
+	// the first retry.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff so a long string of retries doesn't end up
+	// sleeping for an unreasonable amount of time.
+	MaxDelay time.Duration
+
+	// AfterFunc returns a channel that fires after d, as time.After does.
+	// Tests can replace this with a fake clock to avoid real sleeps. If
+	// nil, time.After is used.
+	AfterFunc func(d time.Duration) <-chan time.Time
+}
+
+// after returns c.AfterFunc, defaulting to time.After.
+func (c RetryConfig) after(d time.Duration) <-chan time.Time {
+	if c.AfterFunc != nil {
+		return c.AfterFunc(d)
+	}
+	return time.After(d)
+}
+
+// ResponseError is returned by DoWithRetries when every retry has been
+// exhausted. It wraps the last HTTP response received so callers can
+// inspect the status code and body.
+type ResponseError struct {
+	Response *http.Response
+	Attempts int
 }
 
-// DoWithRetries sends req, retrying on 5xx errors using the provided
-// RetryConfig. It returns the response to the caller and does not return
-// an error on non-2xx responses unless retrying has failed on a 5xx response.
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("request to %v failed after %v attempts with status %v", e.Response.Request.URL, e.Attempts, e.Response.StatusCode)
+}
+
+// retryableStatus reports whether status is worth retrying: server errors,
+// request timeouts, and rate limiting.
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= 500
+}
+
+// DoWithRetries sends req, retrying on 408, 429, and 5xx responses, as
+// well as transient network errors (connection resets, dial timeouts),
+// using exponential backoff with full jitter:
+//
+//	sleep = random(0, min(f.MaxDelay, f.BaseDelay * 2^attempt))
+//
+// A Retry-After header (given in seconds) on any retryable response, such
+// as a 429 or 503, takes priority over the computed backoff. Retries stop early if req's context is
+// canceled. DoWithRetries returns the last response along with a
+// *ResponseError if retries are exhausted on a retryable status; it
+// returns a transport error unwrapped if the final attempt fails before
+// a response is received.
 func DoWithRetries(c *http.Client, req *http.Request, f RetryConfig) (*http.Response, error) {
-	remaining := f.MaxRetries
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		resp, err = c.Do(req)
+
+		if err != nil {
+			if attempt >= f.MaxRetries || !isRetryableError(err) {
+				return nil, err
+			}
+		} else if !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		} else if attempt >= f.MaxRetries {
+			return resp, &ResponseError{Response: resp, Attempts: attempt + 1}
+		}
+
+		retryObserver()
+
+		delay := backoffDelay(f, attempt)
+		if resp != nil {
+			if ra, ok := retryAfter(resp); ok {
+				delay = ra
+			}
+			// We're about to retry and discard resp, so drain and close its
+			// body now. Leaving it unread/unclosed would leak the
+			// underlying connection, since net/http only reuses a
+			// connection once its response body is read to EOF and closed.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
 
-send:
-	resp, err := c.Do(req)
+		select {
+		case <-req.Context().Done():
+			return resp, req.Context().Err()
+		case <-f.after(delay):
+		}
+
+		if err := resetBody(req); err != nil {
+			return resp, fmt.Errorf("cannot retry a request whose body can't be rewound: %v", err)
+		}
+	}
+}
+
+// resetBody rewinds req's body before a retry. The first attempt already
+// drained req.Body, so without this a retried request with a body (e.g. an
+// upload PUT) would silently send an empty one. req.GetBody is populated
+// automatically by http.NewRequest for in-memory bodies like
+// *bytes.Reader, *bytes.Buffer, and *strings.Reader; requests built with
+// any other body type can't be retried safely and return an error instead.
+func resetBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil {
+		return errors.New("request has a body but no GetBody to rewind it with")
+	}
 
+	body, err := req.GetBody()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	req.Body = body
+	return nil
+}
 
-	switch resp.StatusCode - (resp.StatusCode % 100) {
-	// Retry in the case of server errors
-	case 500:
-		// We can retry, so wait a bit and try again.
-		if remaining > 0 {
-			remaining--
-			time.Sleep(f.IntervalBetweenRetries)
-			goto send
-		}
-		return resp, fmt.Errorf("the request to %v failed after %v retries", req.URL.String(), f.MaxRetries)
-	default:
-		return resp, nil
+// isRetryableError reports whether err, returned from http.Client.Do,
+// represents a transient failure worth retrying, such as a dial timeout
+// or a connection reset.
+func isRetryableError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || netErr.Temporary()
 	}
+	return false
+}
+
+// retryAfter parses resp's Retry-After header, if present, as a number of
+// seconds to wait before the next attempt.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+
+	secs, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// backoffDelay computes a jittered exponential backoff for the given
+// attempt number (0-indexed), following the "full jitter" strategy:
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func backoffDelay(f RetryConfig, attempt int) time.Duration {
+	maxDelay := f.MaxDelay
+	base := f.BaseDelay
+	if base <= 0 {
+		base = time.Second
+	}
+
+	d := base * time.Duration(1<<uint(attempt))
+	if maxDelay > 0 && d > maxDelay {
+		d = maxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
 }
@@ -0,0 +1,311 @@
+package apiclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// instant is an AfterFunc that fires immediately, so retry tests don't have
+// to wait out real backoff sleeps.
+func instant(d time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	c <- time.Now()
+	return c
+}
+
+func TestDoWithRetriesSucceedsAfterTransientErrors(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building the request: %v", err)
+	}
+
+	resp, err := DoWithRetries(http.DefaultClient, req, RetryConfig{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		AfterFunc:  instant,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error from DoWithRetries: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected a 200 response but got %v", resp.StatusCode)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts but got %v", attempts)
+	}
+}
+
+func TestDoWithRetriesRewindsBodyBetweenAttempts(t *testing.T) {
+	var attempts int
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("PUT", srv.URL, bytes.NewReader([]byte("backup contents")))
+	if err != nil {
+		t.Fatalf("unexpected error building the request: %v", err)
+	}
+
+	resp, err := DoWithRetries(http.DefaultClient, req, RetryConfig{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		AfterFunc:  instant,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error from DoWithRetries: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected a 200 response but got %v", resp.StatusCode)
+	}
+
+	if len(bodies) != 3 {
+		t.Fatalf("expected 3 attempts but got %v", len(bodies))
+	}
+	for i, b := range bodies {
+		if b != "backup contents" {
+			t.Fatalf("attempt %v: expected the full body to be resent, got %q", i, b)
+		}
+	}
+}
+
+// trackedBody wraps a response body, recording whether it was ever read to
+// EOF and closed, so tests can assert DoWithRetries doesn't leak connections
+// by abandoning a discarded retry's response body.
+type trackedBody struct {
+	io.ReadCloser
+	mu              *sync.Mutex
+	drained, closed *bool
+}
+
+func (b trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.mu.Lock()
+		*b.drained = true
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b trackedBody) Close() error {
+	b.mu.Lock()
+	*b.closed = true
+	b.mu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+type trackingTransport struct {
+	mu     sync.Mutex
+	bodies []*trackedBody
+}
+
+func (t *trackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tb := &trackedBody{ReadCloser: resp.Body, mu: &t.mu, drained: new(bool), closed: new(bool)}
+	t.bodies = append(t.bodies, tb)
+	resp.Body = tb
+	return resp, nil
+}
+
+func TestDoWithRetriesClosesDiscardedResponseBodies(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "try again")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	tr := &trackingTransport{}
+	client := &http.Client{Transport: tr}
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building the request: %v", err)
+	}
+
+	resp, err := DoWithRetries(client, req, RetryConfig{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		AfterFunc:  instant,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error from DoWithRetries: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if len(tr.bodies) != 3 {
+		t.Fatalf("expected 3 responses but got %v", len(tr.bodies))
+	}
+
+	for i, b := range tr.bodies[:len(tr.bodies)-1] {
+		if !*b.drained {
+			t.Fatalf("discarded response %v: expected the body to be drained to EOF", i)
+		}
+		if !*b.closed {
+			t.Fatalf("discarded response %v: expected the body to be closed", i)
+		}
+	}
+}
+
+func TestDoWithRetriesExhausted(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building the request: %v", err)
+	}
+
+	_, err = DoWithRetries(http.DefaultClient, req, RetryConfig{
+		MaxRetries: 2,
+		BaseDelay:  time.Millisecond,
+		AfterFunc:  instant,
+	})
+	if err == nil {
+		t.Fatal("expected an error once retries were exhausted")
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts (1 + 2 retries) but got %v", attempts)
+	}
+
+	respErr, ok := err.(*ResponseError)
+	if !ok {
+		t.Fatalf("expected a *ResponseError but got %T: %v", err, err)
+	}
+	if respErr.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the wrapped response to have status 503, got %v", respErr.Response.StatusCode)
+	}
+}
+
+func TestSetRetryObserver(t *testing.T) {
+	var calls int
+	SetRetryObserver(func() { calls++ })
+	defer SetRetryObserver(nil)
+
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building the request: %v", err)
+	}
+
+	if _, err := DoWithRetries(http.DefaultClient, req, RetryConfig{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		AfterFunc:  instant,
+	}); err != nil {
+		t.Fatalf("unexpected error from DoWithRetries: %v", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected the retry observer to fire twice (for the 2 retries before success), got %v", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cases := []struct {
+		description string
+		header      string
+		want        time.Duration
+		wantOK      bool
+	}{
+		{
+			description: "no header",
+			header:      "",
+			wantOK:      false,
+		},
+		{
+			description: "seconds",
+			header:      "30",
+			want:        30 * time.Second,
+			wantOK:      true,
+		},
+		{
+			description: "not a number",
+			header:      "Wed, 21 Oct 2015 07:28:00 GMT",
+			wantOK:      false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tc.header != "" {
+				resp.Header.Set("Retry-After", tc.header)
+			}
+
+			got, ok := retryAfter(resp)
+			if ok != tc.wantOK {
+				t.Fatalf("expected ok=%v but got %v", tc.wantOK, ok)
+			}
+			if ok && got != tc.want {
+				t.Fatalf("expected delay %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBackoffDelayRespectsMaxDelay(t *testing.T) {
+	f := RetryConfig{BaseDelay: time.Second, MaxDelay: 2 * time.Second}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		d := backoffDelay(f, attempt)
+		if d > f.MaxDelay {
+			t.Fatalf("attempt %v: delay %v exceeded MaxDelay %v", attempt, d, f.MaxDelay)
+		}
+		if d < 0 {
+			t.Fatalf("attempt %v: delay %v was negative", attempt, d)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package dropbox implements a storage.Backend that uploads, lists, and
+// deletes Todoist backups in a Dropbox account, talking directly to the
+// Dropbox API v2 over HTTP rather than pulling in the official (and much
+// heavier) Dropbox SDK.
+package dropbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ptgott/todoist-backups/apiclient"
+	"github.com/ptgott/todoist-backups/storage"
+)
+
+// Config contains options for the Dropbox backend.
+type Config struct {
+	// AccessToken authenticates against the Dropbox API. Generate one for
+	// a scoped app at https://www.dropbox.com/developers/apps.
+	AccessToken string `yaml:"access_token"`
+	// Directory backups are uploaded into, relative to the app's root,
+	// e.g. "/backups". Defaults to the root if empty.
+	Directory string `yaml:"directory"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.AccessToken == "" {
+		return errors.New("must provide an access_token")
+	}
+	return nil
+}
+
+// retries used for every Dropbox API call made by this package.
+var dropboxRetryConfig = apiclient.RetryConfig{
+	BaseDelay:  time.Second,
+	MaxDelay:   time.Minute,
+	MaxRetries: 5,
+}
+
+// uploadURL is the Dropbox simple-upload endpoint. It's a variable so tests
+// can point it at an httptest server.
+var uploadURL = "https://content.dropboxapi.com/2/files/upload"
+
+// Backend uploads, lists, and deletes Todoist backups in a single Dropbox
+// directory. It implements storage.Backend.
+type Backend struct {
+	token string
+	dir   string
+}
+
+// NewBackend builds a Backend that authenticates against Dropbox using c.
+func NewBackend(c Config) *Backend {
+	return &Backend{token: c.AccessToken, dir: strings.TrimSuffix(c.Directory, "/")}
+}
+
+// String identifies this backend in log messages and aggregated errors.
+func (b *Backend) String() string {
+	return "dropbox"
+}
+
+// path returns the Dropbox path name is stored under, accounting for dir.
+func (b *Backend) path(name string) string {
+	return b.dir + "/" + strings.TrimPrefix(name, "/")
+}
+
+// Upload sends the contents of r to the configured Dropbox directory under
+// name.
+//
+// The Dropbox upload endpoint needs the whole request body in one HTTP
+// call and benefits from a rewindable body so a retried request resends
+// the same bytes, so Upload buffers r in full rather than streaming it,
+// as the onedrive backend also does (there, because it needs the total
+// size up front).
+func (b *Backend) Upload(ctx context.Context, name string, r io.Reader) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("unable to buffer the upload body: %v", err)
+	}
+
+	arg, err := json.Marshal(map[string]string{
+		"path": b.path(name),
+		"mode": "overwrite",
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	req.Header.Set("Dropbox-API-Arg", string(arg))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := apiclient.DoWithRetries(http.DefaultClient, req, dropboxRetryConfig)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("got unexpected response code uploading %v: %v", name, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// metadata is the subset of a Dropbox FileMetadata entry this package
+// cares about.
+type metadata struct {
+	Tag            string `json:".tag"`
+	Name           string `json:"name"`
+	ServerModified string `json:"server_modified"`
+}
+
+// List returns every backup object in the configured Dropbox directory.
+func (b *Backend) List(ctx context.Context) ([]storage.BackupObject, error) {
+	reqBody, err := json.Marshal(map[string]any{"path": b.dir})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.dropboxapi.com/2/files/list_folder", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := apiclient.DoWithRetries(http.DefaultClient, req, dropboxRetryConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("got unexpected response code listing %v: %v", b.dir, resp.StatusCode)
+	}
+
+	var out struct {
+		Entries []metadata `json:"entries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("unable to parse the list_folder response: %v", err)
+	}
+
+	objs := make([]storage.BackupObject, 0, len(out.Entries))
+	for _, e := range out.Entries {
+		if e.Tag != "file" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, e.ServerModified)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, storage.BackupObject{Name: e.Name, ModTime: t})
+	}
+
+	return objs, nil
+}
+
+// Delete removes the object named name from the configured Dropbox
+// directory. It's not an error for the object to already be absent.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	reqBody, err := json.Marshal(map[string]string{"path": b.path(name)})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.dropboxapi.com/2/files/delete_v2", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := apiclient.DoWithRetries(http.DefaultClient, req, dropboxRetryConfig)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 409 {
+		// A 409 with a path_lookup/not_found error means the file is
+		// already gone, which isn't a failure for our purposes.
+		return nil
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("got unexpected response code deleting %v: %v", name, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package dropbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid config",
+			conf:        Config{AccessToken: "a-token"},
+			errSubstr:   "",
+		},
+		{
+			description: "missing access token",
+			conf:        Config{},
+			errSubstr:   "access_token",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestBackendPath(t *testing.T) {
+	b := NewBackend(Config{AccessToken: "t", Directory: "/backups"})
+	if got, want := b.path("backup.zip"), "/backups/backup.zip"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestUploadSendsExpectedRequest(t *testing.T) {
+	var gotArg string
+	var gotBody string
+	var gotAuth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotArg = r.Header.Get("Dropbox-API-Arg")
+		gotAuth = r.Header.Get("Authorization")
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	oldUploadURL := uploadURL
+	uploadURL = srv.URL
+	defer func() { uploadURL = oldUploadURL }()
+
+	b := NewBackend(Config{AccessToken: "a-token", Directory: "/backups"})
+	if err := b.Upload(context.Background(), "backup.zip", strings.NewReader("contents")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotAuth != "Bearer a-token" {
+		t.Fatalf("expected Authorization header to be set, got %q", gotAuth)
+	}
+	if gotBody != "contents" {
+		t.Fatalf("expected the body to be uploaded, got %q", gotBody)
+	}
+
+	var arg struct {
+		Path string `json:"path"`
+		Mode string `json:"mode"`
+	}
+	if err := json.Unmarshal([]byte(gotArg), &arg); err != nil {
+		t.Fatalf("unexpected error parsing Dropbox-API-Arg: %v", err)
+	}
+	if arg.Path != "/backups/backup.zip" {
+		t.Fatalf("expected path /backups/backup.zip, got %q", arg.Path)
+	}
+	if arg.Mode != "overwrite" {
+		t.Fatalf("expected mode overwrite, got %q", arg.Mode)
+	}
+}
@@ -0,0 +1,250 @@
+// Package encryption wraps backup archives in a streaming, passphrase-based
+// cipher before they're handed to a storage.Backend, so that a compromised
+// (or simply untrusted) third-party destination never sees plaintext
+// Todoist data.
+//
+// The format is a sequence of independently-sealed AES-256-GCM chunks, each
+// framed with a 4-byte big-endian length prefix, preceded by the scrypt
+// salt used to derive the key from the passphrase. This keeps both
+// encryption and decryption streaming: neither side needs to hold the full
+// archive in memory.
+//
+// The last chunk is sealed with an authenticated "final" flag (the high bit
+// of its length prefix, included in GCM's additional data), so a stream
+// truncated by a flaky network or a malicious storage destination is
+// detected as an error rather than decrypting cleanly as a short file.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Config controls client-side encryption of backups before upload.
+type Config struct {
+	// Passphrase used to derive the encryption key. Keep this outside of
+	// version control; anyone with it can decrypt your backups.
+	Passphrase string `yaml:"passphrase"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.Passphrase == "" {
+		return errors.New("must provide a passphrase")
+	}
+	return nil
+}
+
+// Extension is appended to the filename of an encrypted backup.
+const Extension = ".enc"
+
+const (
+	saltSize  = 16
+	nonceSize = 12
+	// chunkSize is the amount of plaintext sealed into each GCM chunk. It's
+	// intentionally small relative to a Todoist backup so neither the
+	// encryptor nor the decryptor needs to buffer the whole archive.
+	chunkSize = 64 * 1024
+)
+
+// finalChunkBit is set in a chunk's length prefix to mark it as the last
+// chunk in the stream. It's included in the chunk's GCM additional data, so
+// an attacker can't flip it on a truncated stream without invalidating the
+// auth tag.
+const finalChunkBit uint32 = 1 << 31
+
+// finalAAD returns the additional data a chunk is sealed/opened with,
+// based on whether it's the last chunk in the stream.
+func finalAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// deriveKey derives a 32-byte AES-256 key from passphrase and salt using
+// scrypt with parameters recommended for interactive use as of 2017 (N=2^15).
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// EncryptingReader wraps r, a stream of plaintext, into a stream of the
+// chunked AES-GCM ciphertext format described in the package doc.
+func EncryptingReader(passphrase string, r io.Reader) (io.Reader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("unable to generate a salt: %v", err)
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive an encryption key: %v", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptingReader{gcm: gcm, src: r, header: salt}, nil
+}
+
+// DecryptingReader wraps r, a stream previously produced by
+// EncryptingReader, into a stream of the original plaintext.
+func DecryptingReader(passphrase string, r io.Reader) (io.Reader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, fmt.Errorf("unable to read the encryption salt: %v", err)
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive a decryption key: %v", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptingReader{gcm: gcm, src: r}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build an AES cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptingReader reads plaintext from src in chunkSize blocks, seals each
+// one, and serves the framed ciphertext (and, on the first Read, the
+// header) from an internal buffer.
+type encryptingReader struct {
+	gcm    cipher.AEAD
+	src    io.Reader
+	header []byte
+	buf    []byte
+	seq    uint64
+	done   bool
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.header != nil {
+			e.buf = e.header
+			e.header = nil
+			break
+		}
+
+		if e.done {
+			return 0, io.EOF
+		}
+
+		chunk := make([]byte, chunkSize)
+		n, err := io.ReadFull(e.src, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return 0, err
+		}
+
+		// Every stream ends in exactly one chunk marked final, even if it's
+		// empty (the source's length happened to be an exact multiple of
+		// chunkSize), so the decryptor always has an authenticated end
+		// marker to check for.
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if final {
+			e.done = true
+		}
+
+		sealed := e.gcm.Seal(nil, e.nonce(), chunk[:n], finalAAD(final))
+		e.buf = append(lengthPrefix(len(sealed), final), sealed...)
+	}
+
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+func (e *encryptingReader) nonce() []byte {
+	n := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(n[nonceSize-8:], e.seq)
+	e.seq++
+	return n
+}
+
+// decryptingReader reads the chunked ciphertext format from src, opens each
+// chunk, and serves the plaintext from an internal buffer.
+type decryptingReader struct {
+	gcm  cipher.AEAD
+	src  io.Reader
+	buf  []byte
+	seq  uint64
+	done bool
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		var lp [4]byte
+		if _, err := io.ReadFull(d.src, lp[:]); err != nil {
+			if err == io.EOF {
+				return 0, errors.New("backup is truncated: stream ended before its final chunk was received")
+			}
+			return 0, fmt.Errorf("unable to read a chunk length: %v", err)
+		}
+
+		raw := binary.BigEndian.Uint32(lp[:])
+		final := raw&finalChunkBit != 0
+		size := raw &^ finalChunkBit
+
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(d.src, sealed); err != nil {
+			return 0, fmt.Errorf("unable to read a sealed chunk: %v", err)
+		}
+
+		plain, err := d.gcm.Open(nil, d.nonce(), sealed, finalAAD(final))
+		if err != nil {
+			return 0, fmt.Errorf("unable to decrypt a chunk (wrong passphrase, truncated backup, or corrupted data): %v", err)
+		}
+
+		if final {
+			d.done = true
+		}
+		d.buf = plain
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) nonce() []byte {
+	n := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(n[nonceSize-8:], d.seq)
+	d.seq++
+	return n
+}
+
+// lengthPrefix encodes a sealed chunk's length, n, as a 4-byte big-endian
+// prefix, setting finalChunkBit if this is the stream's last chunk.
+func lengthPrefix(n int, final bool) []byte {
+	v := uint32(n)
+	if final {
+		v |= finalChunkBit
+	}
+
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return b[:]
+}
@@ -0,0 +1,146 @@
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid config",
+			conf:        Config{Passphrase: "hunter2"},
+			errSubstr:   "",
+		},
+		{
+			description: "missing passphrase",
+			conf:        Config{},
+			errSubstr:   "passphrase",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	cases := []struct {
+		description string
+		plaintext   []byte
+	}{
+		{
+			description: "empty input",
+			plaintext:   nil,
+		},
+		{
+			description: "smaller than a chunk",
+			plaintext:   []byte("a small todoist backup"),
+		},
+		{
+			description: "exactly one chunk",
+			plaintext:   bytes.Repeat([]byte("x"), chunkSize),
+		},
+		{
+			description: "spans multiple chunks",
+			plaintext:   bytes.Repeat([]byte("y"), chunkSize*2+17),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			enc, err := EncryptingReader("a passphrase", bytes.NewReader(tc.plaintext))
+			if err != nil {
+				t.Fatalf("unexpected error from EncryptingReader: %v", err)
+			}
+
+			ciphertext, err := io.ReadAll(enc)
+			if err != nil {
+				t.Fatalf("unexpected error reading ciphertext: %v", err)
+			}
+
+			dec, err := DecryptingReader("a passphrase", bytes.NewReader(ciphertext))
+			if err != nil {
+				t.Fatalf("unexpected error from DecryptingReader: %v", err)
+			}
+
+			got, err := io.ReadAll(dec)
+			if err != nil {
+				t.Fatalf("unexpected error reading plaintext: %v", err)
+			}
+
+			if !bytes.Equal(got, tc.plaintext) {
+				t.Fatalf("round trip did not preserve plaintext (lengths: got %v, want %v)", len(got), len(tc.plaintext))
+			}
+		})
+	}
+}
+
+func TestDecryptingReaderDetectsTruncation(t *testing.T) {
+	enc, err := EncryptingReader("a passphrase", bytes.NewReader(bytes.Repeat([]byte("z"), chunkSize*2+17)))
+	if err != nil {
+		t.Fatalf("unexpected error from EncryptingReader: %v", err)
+	}
+
+	ciphertext, err := io.ReadAll(enc)
+	if err != nil {
+		t.Fatalf("unexpected error reading ciphertext: %v", err)
+	}
+
+	// Drop the final chunk (and its length prefix) so the stream looks like
+	// a clean, if short, file rather than an obviously malformed one. The
+	// final chunk is a 4-byte length prefix plus 17 bytes of plaintext
+	// sealed with a 16-byte GCM tag.
+	truncated := ciphertext[:len(ciphertext)-(4+17+16)]
+
+	dec, err := DecryptingReader("a passphrase", bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatalf("unexpected error from DecryptingReader: %v", err)
+	}
+
+	if _, err := io.ReadAll(dec); err == nil {
+		t.Fatal("expected an error reading a truncated backup, got nil")
+	}
+}
+
+func TestDecryptingReaderWrongPassphrase(t *testing.T) {
+	enc, err := EncryptingReader("correct passphrase", strings.NewReader("secret data"))
+	if err != nil {
+		t.Fatalf("unexpected error from EncryptingReader: %v", err)
+	}
+
+	ciphertext, err := io.ReadAll(enc)
+	if err != nil {
+		t.Fatalf("unexpected error reading ciphertext: %v", err)
+	}
+
+	dec, err := DecryptingReader("wrong passphrase", bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("unexpected error from DecryptingReader: %v", err)
+	}
+
+	if _, err := io.ReadAll(dec); err == nil {
+		t.Fatal("expected an error decrypting with the wrong passphrase")
+	}
+}
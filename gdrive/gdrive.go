@@ -5,9 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"time"
 
+	"github.com/ptgott/todoist-backups/storage"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 )
@@ -35,46 +36,104 @@ func (c Config) Validate() error {
 	return nil
 }
 
-// UploadFile uploads the file in r to Google Drive with the provided name.
-// The containing folder (Config.FolderName) must exist and be shared
-// with the Todoist backupos service account prior to the upload.
-func UploadFile(r io.Reader, filename string, c Config) error {
-	ctx := context.Background()
+// Backend uploads, lists, and deletes Todoist backups in a single Google
+// Drive folder. It implements storage.Backend.
+type Backend struct {
+	srv      *drive.Service
+	folderID string
+}
 
+// NewBackend authenticates against the Google Drive API using c and
+// resolves the ID of c.FolderName. The containing folder must already
+// exist and be shared with the Todoist backups service account.
+func NewBackend(ctx context.Context, c Config) (*Backend, error) {
 	srv, err := drive.NewService(ctx, option.WithCredentialsFile(c.CredentialsPath))
 	if err != nil {
-		log.Fatalf("Unable to retrieve Drive client: %v", err)
+		return nil, fmt.Errorf("unable to retrieve Drive client: %v", err)
 	}
 
-	var d string // the ID of the directory to write to
-
 	l, err := srv.Files.List().Q(fmt.Sprintf("name='%v'", c.FolderName)).Do()
-
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	switch len(l.Files) {
 	case 0:
-		return fmt.Errorf("could not find backup folder %q", c.FolderName)
+		return nil, fmt.Errorf("could not find backup folder %q", c.FolderName)
 	case 1:
-		// Use the ID of the existing folder
-		d = l.Files[0].Id
+		return &Backend{srv: srv, folderID: l.Files[0].Id}, nil
 	default:
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"unexpected number of Todoist backup folders: %v files named %q",
 			len(l.Files),
 			c.FolderName,
 		)
 	}
+}
 
-	if _, err := srv.Files.Create(&drive.File{
+// String identifies this backend in log messages and aggregated errors.
+func (b *Backend) String() string {
+	return "google_drive"
+}
+
+// Upload uploads the file in r to the Google Drive folder resolved by
+// NewBackend, under name.
+func (b *Backend) Upload(ctx context.Context, name string, r io.Reader) error {
+	_, err := b.srv.Files.Create(&drive.File{
 		MimeType: "application/zip",
-		Name:     filename,
-		Parents:  []string{d},
-	}).Media(r).Context(ctx).Do(); err != nil {
+		Name:     name,
+		Parents:  []string{b.folderID},
+	}).Media(r).Context(ctx).Do()
+
+	return err
+}
+
+// List returns every backup object in the Google Drive folder resolved by
+// NewBackend.
+func (b *Backend) List(ctx context.Context) ([]storage.BackupObject, error) {
+	l, err := b.srv.Files.List().
+		Q(fmt.Sprintf("'%v' in parents", b.folderID)).
+		Fields("files(name, modifiedTime)").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]storage.BackupObject, 0, len(l.Files))
+	for _, f := range l.Files {
+		t, err := parseModifiedTime(f.ModifiedTime)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, storage.BackupObject{Name: f.Name, ModTime: t})
+	}
+
+	return objs, nil
+}
+
+// Delete removes the object named name from the Google Drive folder
+// resolved by NewBackend.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	l, err := b.srv.Files.List().
+		Q(fmt.Sprintf("'%v' in parents and name='%v'", b.folderID, name)).
+		Context(ctx).
+		Do()
+	if err != nil {
 		return err
 	}
 
+	for _, f := range l.Files {
+		if err := b.srv.Files.Delete(f.Id).Context(ctx).Do(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// parseModifiedTime parses the RFC 3339 timestamp the Drive API returns in
+// the modifiedTime field.
+func parseModifiedTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,101 @@
+// Package localfs implements a storage.Backend that writes Todoist backups
+// to a directory on local disk. It's useful on its own for on-host
+// retention and as a destination alongside the cloud backends.
+package localfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ptgott/todoist-backups/storage"
+)
+
+// Config contains options for the local filesystem backend.
+type Config struct {
+	// Directory where backups are written. Must already exist.
+	Directory string `yaml:"directory"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.Directory == "" {
+		return errors.New("must provide a directory")
+	}
+
+	fi, err := os.Stat(c.Directory)
+	if err != nil {
+		return errors.New("cannot find a directory at the configured path")
+	}
+	if !fi.IsDir() {
+		return errors.New("the configured path is not a directory")
+	}
+
+	return nil
+}
+
+// Backend writes Todoist backups to Config.Directory. It implements
+// storage.Backend.
+type Backend struct {
+	dir string
+}
+
+// NewBackend returns a Backend that writes to c.Directory.
+func NewBackend(c Config) *Backend {
+	return &Backend{dir: c.Directory}
+}
+
+// String identifies this backend in log messages and aggregated errors.
+func (b *Backend) String() string {
+	return "local_filesystem"
+}
+
+// Upload writes the contents of r to name within the backend's directory.
+func (b *Backend) Upload(ctx context.Context, name string, r io.Reader) error {
+	f, err := os.Create(filepath.Join(b.dir, name))
+	if err != nil {
+		return fmt.Errorf("unable to create %v: %v", name, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("unable to write %v: %v", name, err)
+	}
+
+	return nil
+}
+
+// List returns every backup object in the backend's directory.
+func (b *Backend) List(ctx context.Context) ([]storage.BackupObject, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]storage.BackupObject, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, storage.BackupObject{Name: e.Name(), ModTime: info.ModTime()})
+	}
+
+	return objs, nil
+}
+
+// Delete removes the object named name from the backend's directory. It's
+// not an error for the object to already be absent.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(b.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package localfs
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid config",
+			conf:        Config{Directory: dir},
+			errSubstr:   "",
+		},
+		{
+			description: "missing directory",
+			conf:        Config{},
+			errSubstr:   "directory",
+		},
+		{
+			description: "directory does not exist",
+			conf:        Config{Directory: dir + "/does-not-exist"},
+			errSubstr:   "directory",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+
+			if err == nil && tc.errSubstr == "" {
+				return
+			}
+
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestUploadListDelete(t *testing.T) {
+	dir := t.TempDir()
+	b := NewBackend(Config{Directory: dir})
+	ctx := context.Background()
+
+	if err := b.Upload(ctx, "backup.zip", strings.NewReader("contents")); err != nil {
+		t.Fatalf("unexpected error from Upload: %v", err)
+	}
+
+	objs, err := b.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	if len(objs) != 1 || objs[0].Name != "backup.zip" {
+		t.Fatalf("expected a single backup.zip object but got %+v", objs)
+	}
+
+	if err := b.Delete(ctx, "backup.zip"); err != nil {
+		t.Fatalf("unexpected error from Delete: %v", err)
+	}
+
+	if _, err := os.Stat(dir + "/backup.zip"); !os.IsNotExist(err) {
+		t.Fatalf("expected backup.zip to be removed")
+	}
+
+	// Deleting an already-absent object is not an error.
+	if err := b.Delete(ctx, "backup.zip"); err != nil {
+		t.Fatalf("unexpected error deleting an absent object: %v", err)
+	}
+}
@@ -1,23 +1,47 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
 	"time"
 
 	"github.com/go-yaml/yaml"
+	"github.com/ptgott/todoist-backups/apiclient"
 	"github.com/ptgott/todoist-backups/config"
+	"github.com/ptgott/todoist-backups/dropbox"
+	"github.com/ptgott/todoist-backups/encryption"
 	"github.com/ptgott/todoist-backups/gdrive"
+	"github.com/ptgott/todoist-backups/localfs"
+	"github.com/ptgott/todoist-backups/metrics"
+	"github.com/ptgott/todoist-backups/notifications"
+	"github.com/ptgott/todoist-backups/onedrive"
+	"github.com/ptgott/todoist-backups/retention"
+	"github.com/ptgott/todoist-backups/s3"
+	"github.com/ptgott/todoist-backups/sftp"
+	"github.com/ptgott/todoist-backups/storage"
 	"github.com/ptgott/todoist-backups/todoist"
+	"github.com/ptgott/todoist-backups/webdav"
 	"github.com/rs/zerolog/log"
 )
 
 type Config struct {
-	General     config.General `yaml:"general"`
-	GoogleDrive gdrive.Config  `yaml:"google_drive"`
+	General       config.General        `yaml:"general"`
+	GoogleDrive   *gdrive.Config        `yaml:"google_drive"`
+	OneDrive      *onedrive.Config      `yaml:"onedrive"`
+	LocalFS       *localfs.Config       `yaml:"local_filesystem"`
+	S3            *s3.Config            `yaml:"s3"`
+	WebDAV        *webdav.Config        `yaml:"webdav"`
+	Dropbox       *dropbox.Config       `yaml:"dropbox"`
+	SFTP          *sftp.Config          `yaml:"sftp"`
+	Retention     *retention.Config     `yaml:"retention"`
+	Encryption    *encryption.Config    `yaml:"encryption"`
+	Notifications *notifications.Config `yaml:"notifications"`
+	Metrics       *metrics.Config       `yaml:"metrics"`
 }
 
 // For LimitReaders: 5MB
@@ -32,9 +56,12 @@ general:
 
 	todoist_api_key: the API key retrieved from Todoist
 
-	backup_interval: How often to conduct the backup. A duration string like 1m, 
+	backup_interval: How often to conduct the backup. A duration string like 1m,
 	4h, or 3d.
 
+You must configure at least one backup destination. Any combination of the
+following may be included:
+
 google_drive:
 	token_path: path to your Google Workspace token file, which is created when
 	you first complete the authorization flow.
@@ -42,43 +69,331 @@ google_drive:
 	credentials_path: path to a Google Workspace credentials file, which you
 	can export for the service account that you created for this app.
 
-	folder_name: name of the Google Drive directory you want to write 
+	folder_name: name of the Google Drive directory you want to write
 	backups to. This will be a single folder at the root of your Drive.
 
 	The Todoist backup job will be limited to this directory.
 
+onedrive:
+	tenant_id, client_id, client_secret: the credentials of the Azure AD
+	application you registered for this tool. Backups are written to the
+	app's special "approot" folder.
+
+local_filesystem:
+	directory: path to a directory on local disk to write backups to. Must
+	already exist.
+
+s3:
+	bucket: name of an S3 bucket backups are uploaded to. Must already exist.
+
+	region: the AWS region the bucket lives in.
+
+	prefix: optional prefix prepended to every object key.
+
+	access_key_id, secret_access_key: optional static credentials. If
+	omitted, the AWS SDK's default credential chain is used instead (env
+	vars, shared config, an instance/task role).
+
+	endpoint: optional override for S3-compatible providers like MinIO or
+	Backblaze B2.
+
+webdav:
+	url: base address of the WebDAV server, including any path to the
+	directory backups should be written into, e.g.
+	"https://example.com/remote.php/dav/files/user/backups".
+
+	username, password: optional HTTP Basic auth credentials. Leave both
+	empty for an unauthenticated server.
+
+dropbox:
+	access_token: a Dropbox API access token, generated for a scoped app at
+	https://www.dropbox.com/developers/apps.
+
+	directory: optional directory backups are uploaded into, relative to
+	the app's root, e.g. "/backups". Defaults to the root if omitted.
+
+sftp:
+	host, port: address of the SFTP server. port defaults to 22.
+
+	username: the user to authenticate as.
+
+	password: password to authenticate with. Leave empty if using
+	private_key_path instead.
+
+	private_key_path: path to a private key file to authenticate with, as
+	an alternative to password.
+
+	directory: path to a directory on the remote server to write backups
+	to. Must already exist.
+
+You can optionally include a retention block to prune old backups from
+every configured destination after each successful upload:
+
+retention:
+	keep_last: always keep the N most recent backups.
+	keep_daily: keep the most recent backup from each of the last N days
+	that have a backup.
+	keep_weekly: keep the most recent backup from each of the last N weeks
+	that have a backup.
+	keep_monthly: keep the most recent backup from each of the last N
+	months that have a backup.
+
+	At least one of the above must be set. A backup is kept if it falls
+	into any of the configured buckets.
+
+You can optionally include an encryption block to encrypt backups with a
+passphrase before they're uploaded:
+
+encryption:
+	passphrase: the passphrase used to derive the encryption key. Keep this
+	somewhere other than version control.
+
+	Encrypted backups are uploaded with a .enc suffix. Use the "decrypt"
+	subcommand to restore one: todoist-backups decrypt -passphrase <passphrase>
+	-in <path to .enc file> -out <path to write the decrypted ZIP to>.
+
+You can optionally include a notifications block to hear about backup
+successes and failures without tailing logs:
+
+notifications:
+	webhooks: a list of { url, level } objects. Each backup run POSTs a
+	JSON-encoded event to url. level is "success", "failure", or "all"
+	(the default).
+
+	email: an { smtp_addr, username, password, from, to, level } object
+	that emails a plaintext summary of each backup run.
+
+	services: a list of { url, level } objects addressing a chat service
+	with a shoutrrr-style URL:
+
+		slack://token-a/token-b/token-c
+		discord://webhook-id/webhook-token
+		telegram://bot-token@telegram?chats=chat-id-1,chat-id-2
+
+A failed backup is logged and reported to your notifiers, but no longer
+stops the daemon; it tries again on the next interval.
+
+You can optionally include a metrics block to expose Prometheus metrics
+and a liveness probe:
+
+metrics:
+	listen_addr: address to serve /metrics and /healthz on, e.g. ":9090".
+
+	unhealthy_after_intervals: number of backup intervals allowed to pass
+	without a successful backup before /healthz starts failing non-200
+	responses. Defaults to 2.
+
 You can optionally use the -oneshot flag to create a single backup without
 running the job as a daemon.
 `
 
-func runBackup(c Config) {
-	ab, err := todoist.GetAvailableBackups(c.General.TodoistAPIKey)
+// backends returns every storage.Backend configured in c.
+func backends(ctx context.Context, c Config) ([]storage.Backend, error) {
+	var bs []storage.Backend
 
+	if c.GoogleDrive != nil {
+		b, err := gdrive.NewBackend(ctx, *c.GoogleDrive)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up the Google Drive backend: %v", err)
+		}
+		bs = append(bs, b)
+	}
+
+	if c.OneDrive != nil {
+		b, err := onedrive.NewBackend(*c.OneDrive)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up the OneDrive backend: %v", err)
+		}
+		bs = append(bs, b)
+	}
+
+	if c.LocalFS != nil {
+		bs = append(bs, localfs.NewBackend(*c.LocalFS))
+	}
+
+	if c.S3 != nil {
+		b, err := s3.NewBackend(ctx, *c.S3)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up the S3 backend: %v", err)
+		}
+		bs = append(bs, b)
+	}
+
+	if c.WebDAV != nil {
+		b, err := webdav.NewBackend(*c.WebDAV)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up the WebDAV backend: %v", err)
+		}
+		bs = append(bs, b)
+	}
+
+	if c.Dropbox != nil {
+		bs = append(bs, dropbox.NewBackend(*c.Dropbox))
+	}
+
+	if c.SFTP != nil {
+		b, err := sftp.NewBackend(*c.SFTP)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up the SFTP backend: %v", err)
+		}
+		bs = append(bs, b)
+	}
+
+	if len(bs) == 0 {
+		return nil, fmt.Errorf("no backup destinations are configured")
+	}
+
+	return bs, nil
+}
+
+// countingReader wraps r, counting the bytes read from it so runBackup can
+// report a backup's size without buffering it separately.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// runBackup downloads the latest Todoist backup and uploads it to every
+// configured destination, pruning old backups, recording metrics, and
+// sending notifications as configured. It returns an error rather than
+// exiting the process, so that a single failed run (e.g. during a Todoist
+// outage) doesn't stop future runs.
+func runBackup(ctx context.Context, c Config, bs []storage.Backend, rec *metrics.Recorder) error {
+	start := time.Now()
+	ev, err := doBackup(ctx, c, bs, start, rec)
+
+	if c.Notifications != nil {
+		if nerr := notifications.Notify(ctx, *c.Notifications, ev); nerr != nil {
+			log.Error().Err(nerr).Msg("Unable to send a backup notification")
+		}
+	}
+
+	return err
+}
+
+// doBackup performs a single backup run and builds the notifications.Event
+// describing it, regardless of whether the run succeeded.
+func doBackup(ctx context.Context, c Config, bs []storage.Backend, start time.Time, rec *metrics.Recorder) (notifications.Event, error) {
+	ab, err := todoist.GetAvailableBackups(ctx, c.General.TodoistAPIKey)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Unable to grab the available backups from Todoist")
+		return failedEvent(start, "", err), fmt.Errorf("unable to grab the available backups from Todoist: %v", err)
 	}
 
 	u, err := todoist.LatestAvailableBackup(ab)
+	if err != nil {
+		return failedEvent(start, "", err), fmt.Errorf("unable to determine the latest available backup from Todoist: %v", err)
+	}
+
+	// GetBackup writes into pw as it downloads, and body reads from the
+	// other end of the pipe (through the encryptor, if configured), so the
+	// backup never needs to be buffered in full before it's uploaded.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(todoist.GetBackup(ctx, pw, c.General.TodoistAPIKey, u.URL, maxResponseBodyBytes))
+	}()
+
+	cr := &countingReader{r: pr}
+	var body io.Reader = cr
+	filename := todoist.BackupFilename(u.Version)
+	if c.Encryption != nil {
+		body, err = encryption.EncryptingReader(c.Encryption.Passphrase, cr)
+		if err != nil {
+			return failedEvent(start, u.Version, err), fmt.Errorf("unable to set up backup encryption: %v", err)
+		}
+		filename += encryption.Extension
+	}
+
+	results, err := storage.UploadAll(ctx, bs, filename, body)
+	if rec != nil {
+		rec.ObserveBackup(start, cr.n, results, err)
+	}
+	ev := notifications.Event{
+		Version:  u.Version,
+		Size:     cr.n,
+		Duration: time.Since(start),
+		Backends: notifications.BackendResultsFrom(results),
+	}
+	if c.Retention != nil {
+		for i, b := range bs {
+			if results[i].Err != nil {
+				// This backend's upload failed this run, so its most recent
+				// backup isn't the one we just made. Pruning it now could
+				// delete the last good backup it has, so skip it rather than
+				// treating a failed backend the same as a healthy one.
+				continue
+			}
+			if err := retention.Prune(ctx, b, *c.Retention); err != nil {
+				log.Error().Err(err).Str("backend", b.String()).Msg("Unable to prune old backups")
+			}
+		}
+	}
+
+	if err != nil {
+		ev.Error = err.Error()
+		return ev, fmt.Errorf("unable to upload the backup to every configured destination: %v", err)
+	}
+
+	return ev, nil
+}
+
+// failedEvent builds a notifications.Event for a run that failed before a
+// storage upload was attempted.
+func failedEvent(start time.Time, version string, err error) notifications.Event {
+	return notifications.Event{
+		Version:  version,
+		Duration: time.Since(start),
+		Error:    err.Error(),
+	}
+}
+
+// runDecrypt implements the "decrypt" subcommand, which restores a backup
+// previously encrypted by runBackup.
+func runDecrypt(args []string) {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	passphrase := fs.String("passphrase", "", "the passphrase the backup was encrypted with")
+	in := fs.String("in", "", "path to the encrypted .enc backup")
+	out := fs.String("out", "", "path to write the decrypted ZIP to")
+	fs.Parse(args)
+
+	if *passphrase == "" || *in == "" || *out == "" {
+		fmt.Println("decrypt requires -passphrase, -in, and -out")
+		os.Exit(1)
+	}
 
+	inFile, err := os.Open(*in)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Unable to determine the latest available backup from Todoist")
+		log.Fatal().Err(err).Str("filepath", *in).Msg("Could not open the encrypted backup")
 	}
+	defer inFile.Close()
 
-	var buf bytes.Buffer
-	if err := todoist.GetBackup(&buf, c.General.TodoistAPIKey, u.URL, maxResponseBodyBytes); err != nil {
-		log.Fatal().Err(err).Msg("Unable to retrieve the latest Todoist backup")
+	r, err := encryption.DecryptingReader(*passphrase, inFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not set up decryption")
+	}
+
+	outFile, err := os.Create(*out)
+	if err != nil {
+		log.Fatal().Err(err).Str("filepath", *out).Msg("Could not create the output file")
 	}
+	defer outFile.Close()
 
-	if err := gdrive.UploadFile(
-		&buf,
-		u.Version,
-		c.GoogleDrive,
-	); err != nil {
-		log.Fatal().Err(err).Msg("Unable to upload a file to Google Drive")
+	if _, err := io.Copy(outFile, r); err != nil {
+		log.Fatal().Err(err).Msg("Could not decrypt the backup")
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "decrypt" {
+		runDecrypt(os.Args[2:])
+		return
+	}
+
 	g := make(chan os.Signal, 1)
 	signal.Notify(g, os.Interrupt)
 
@@ -107,8 +422,70 @@ func main() {
 		log.Fatal().Err(err).Msg("Invalid config")
 	}
 
-	if err := c.GoogleDrive.Validate(); err != nil {
-		log.Fatal().Err(err).Msg("Invalid Google Drive config")
+	if c.GoogleDrive != nil {
+		if err := c.GoogleDrive.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid Google Drive config")
+		}
+	}
+
+	if c.OneDrive != nil {
+		if err := c.OneDrive.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid OneDrive config")
+		}
+	}
+
+	if c.LocalFS != nil {
+		if err := c.LocalFS.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid local filesystem config")
+		}
+	}
+
+	if c.S3 != nil {
+		if err := c.S3.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid S3 config")
+		}
+	}
+
+	if c.WebDAV != nil {
+		if err := c.WebDAV.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid WebDAV config")
+		}
+	}
+
+	if c.Dropbox != nil {
+		if err := c.Dropbox.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid Dropbox config")
+		}
+	}
+
+	if c.SFTP != nil {
+		if err := c.SFTP.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid SFTP config")
+		}
+	}
+
+	if c.Retention != nil {
+		if err := c.Retention.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid retention config")
+		}
+	}
+
+	if c.Encryption != nil {
+		if err := c.Encryption.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid encryption config")
+		}
+	}
+
+	if c.Notifications != nil {
+		if err := c.Notifications.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid notifications config")
+		}
+	}
+
+	if c.Metrics != nil {
+		if err := c.Metrics.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid metrics config")
+		}
 	}
 
 	dur, err := time.ParseDuration(c.General.BackupInterval)
@@ -117,9 +494,40 @@ func main() {
 		log.Fatal().Err(err).Msg("Could not parse the backup interval")
 	}
 
+	var rec *metrics.Recorder
+	if c.Metrics != nil {
+		rec = metrics.NewRecorder()
+		apiclient.SetRetryObserver(rec.IncRetry)
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", rec.Handler())
+		mux.HandleFunc("/healthz", rec.HealthHandler(c.Metrics.UnhealthyAfter(dur)))
+		go func() {
+			if err := http.ListenAndServe(c.Metrics.ListenAddr, mux); err != nil {
+				log.Error().Err(err).Msg("Metrics server stopped")
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-g
+		// Cancel in-flight requests, including a sleeping retry, rather
+		// than waiting out a long backoff before the process can exit.
+		cancel()
+	}()
+
+	bs, err := backends(ctx, c)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not set up the configured backup destinations")
+	}
+
 	// Run the first backup right away so we can identify issues
 	log.Info().Msg("running initial backup")
-	runBackup(c)
+	if err := runBackup(ctx, c, bs, rec); err != nil {
+		log.Error().Err(err).Msg("Initial backup failed")
+	}
 
 	if *oneshot {
 		log.Info().Msg("oneshot selected, exiting")
@@ -131,8 +539,10 @@ func main() {
 		select {
 		case <-k.C:
 			log.Info().Msg("running periodic backup")
-			runBackup(c)
-		case <-g:
+			if err := runBackup(ctx, c, bs, rec); err != nil {
+				log.Error().Err(err).Msg("Backup failed; will try again next interval")
+			}
+		case <-ctx.Done():
 			log.Info().Msg("Received interrupt. Stopping.")
 			os.Exit(0)
 		}
@@ -0,0 +1,160 @@
+// Package metrics exposes Prometheus counters and gauges describing backup
+// runs, plus a /healthz probe, so the daemon can be run under something like
+// Kubernetes with proper liveness/readiness semantics.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ptgott/todoist-backups/storage"
+)
+
+// Config controls the optional metrics/healthz HTTP server.
+type Config struct {
+	// ListenAddr is the address to serve /metrics and /healthz on, e.g.
+	// ":9090". Required whenever a metrics block is present.
+	ListenAddr string `yaml:"listen_addr"`
+
+	// UnhealthyAfterIntervals is the number of backup intervals allowed to
+	// pass without a successful backup before /healthz starts failing.
+	// Defaults to 2.
+	UnhealthyAfterIntervals int `yaml:"unhealthy_after_intervals"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.ListenAddr == "" {
+		return errors.New("listen_addr must be set")
+	}
+	if c.UnhealthyAfterIntervals < 0 {
+		return errors.New("unhealthy_after_intervals must not be negative")
+	}
+	return nil
+}
+
+// UnhealthyAfter returns the duration after which /healthz should start
+// failing, given the configured backup interval.
+func (c Config) UnhealthyAfter(backupInterval time.Duration) time.Duration {
+	n := c.UnhealthyAfterIntervals
+	if n == 0 {
+		n = 2
+	}
+	return time.Duration(n) * backupInterval
+}
+
+// Recorder tracks backup outcomes as Prometheus metrics and the timestamp of
+// the last successful backup, which HealthHandler uses to answer /healthz.
+type Recorder struct {
+	registry *prometheus.Registry
+
+	backupsTotal   *prometheus.CounterVec
+	backupDuration prometheus.Gauge
+	backupSize     prometheus.Gauge
+	lastSuccess    prometheus.Gauge
+	uploadRetries  prometheus.Counter
+
+	mu            sync.Mutex
+	lastSuccessAt time.Time
+}
+
+// NewRecorder creates a Recorder with its own registry, so metrics from
+// multiple Recorders, as in tests, never collide in the global default
+// registry.
+func NewRecorder() *Recorder {
+	reg := prometheus.NewRegistry()
+
+	return &Recorder{
+		registry: reg,
+		backupsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "backups_total",
+			Help: "Total number of backup upload attempts, by outcome and destination.",
+		}, []string{"status", "destination"}),
+		backupDuration: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "backup_duration_seconds",
+			Help: "Duration of the most recent backup run, in seconds.",
+		}),
+		backupSize: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "backup_size_bytes",
+			Help: "Size of the most recently downloaded backup, in bytes.",
+		}),
+		lastSuccess: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "last_success_timestamp_seconds",
+			Help: "Unix timestamp of the last backup that uploaded to every configured destination.",
+		}),
+		uploadRetries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "upload_retries_total",
+			Help: "Total number of HTTP retries made while talking to Todoist or a storage backend.",
+		}),
+	}
+}
+
+// ObserveBackup records the outcome of a single backup run: its duration,
+// the size of the downloaded backup, and a per-destination result. err is
+// the overall error returned by storage.UploadAll, or nil on success.
+func (r *Recorder) ObserveBackup(start time.Time, size int64, results []storage.Result, err error) {
+	r.backupDuration.Set(time.Since(start).Seconds())
+	r.backupSize.Set(float64(size))
+
+	for _, res := range results {
+		status := "success"
+		if res.Err != nil {
+			status = "failure"
+		}
+		r.backupsTotal.WithLabelValues(status, res.Backend).Inc()
+	}
+
+	if err == nil && len(results) > 0 {
+		now := time.Now()
+		r.mu.Lock()
+		r.lastSuccessAt = now
+		r.mu.Unlock()
+		r.lastSuccess.Set(float64(now.Unix()))
+	}
+}
+
+// IncRetry records a single HTTP retry made while talking to Todoist or a
+// storage backend. It's intended to be registered with
+// apiclient.SetRetryObserver.
+func (r *Recorder) IncRetry() {
+	r.uploadRetries.Inc()
+}
+
+// Handler returns an http.Handler serving /metrics in the Prometheus
+// exposition format.
+func (r *Recorder) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// HealthHandler returns an http.HandlerFunc for /healthz that responds
+// non-200 once maxAge has elapsed since the last successful backup. Before
+// the first backup has completed, it reports healthy, since a backup
+// interval can legitimately be longer than the time it takes a pod to come
+// up and get probed.
+func (r *Recorder) HealthHandler(maxAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		last := r.lastSuccessAt
+		r.mu.Unlock()
+
+		if last.IsZero() {
+			fmt.Fprintln(w, "no backup has completed yet")
+			return
+		}
+
+		if age := time.Since(last); age > maxAge {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "last successful backup was %v ago, exceeding %v\n", age.Round(time.Second), maxAge)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ptgott/todoist-backups/storage"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid",
+			conf:        Config{ListenAddr: ":9090"},
+			errSubstr:   "",
+		},
+		{
+			description: "missing listen_addr",
+			conf:        Config{},
+			errSubstr:   "listen_addr",
+		},
+		{
+			description: "negative unhealthy_after_intervals",
+			conf:        Config{ListenAddr: ":9090", UnhealthyAfterIntervals: -1},
+			errSubstr:   "unhealthy_after_intervals",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestHealthHandlerBeforeFirstBackup(t *testing.T) {
+	r := NewRecorder()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/healthz", nil)
+
+	r.HealthHandler(time.Minute)(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("expected status 200 before any backup has completed, got %v", w.Code)
+	}
+}
+
+func TestHealthHandlerAfterStaleBackup(t *testing.T) {
+	r := NewRecorder()
+	r.ObserveBackup(time.Now().Add(-time.Hour), 100, []storage.Result{{Backend: "local_filesystem"}}, nil)
+	// ObserveBackup stamps the success at the time it's called, not at
+	// start, so backdate it to simulate a backup that finished an hour ago.
+	r.lastSuccessAt = r.lastSuccessAt.Add(-time.Hour)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	r.HealthHandler(time.Minute)(w, req)
+
+	if w.Code != 503 {
+		t.Fatalf("expected status 503 once the last backup exceeds maxAge, got %v", w.Code)
+	}
+}
+
+func TestHealthHandlerAfterRecentBackup(t *testing.T) {
+	r := NewRecorder()
+	r.ObserveBackup(time.Now(), 100, []storage.Result{{Backend: "local_filesystem"}}, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	r.HealthHandler(time.Minute)(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("expected status 200 for a recent successful backup, got %v", w.Code)
+	}
+}
@@ -0,0 +1,363 @@
+// Package notifications sends backup success/failure events to webhook,
+// email, and chat service destinations, so an operator doesn't have to
+// tail logs to notice a Todoist outage has stopped backups.
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ptgott/todoist-backups/storage"
+)
+
+// level controls which outcomes a notifier fires on.
+type level string
+
+const (
+	levelAll     level = "all"
+	levelSuccess level = "success"
+	levelFailure level = "failure"
+)
+
+// Config holds every notifier that should be invoked from runBackup.
+type Config struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Email    *EmailConfig    `yaml:"email"`
+	Services []ServiceConfig `yaml:"services"`
+}
+
+// ServiceConfig sends an Event through a chat service, addressed with a
+// shoutrrr-style service URL: slack://token-a/token-b/token-c,
+// discord://webhook-id/webhook-token, or
+// telegram://bot-token@telegram?chats=chat-id-1,chat-id-2.
+type ServiceConfig struct {
+	URL string `yaml:"url"`
+	// Level is one of "success", "failure", or "all" (the default).
+	Level string `yaml:"level"`
+}
+
+// WebhookConfig POSTs a JSON-encoded Event to URL.
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	// Level is one of "success", "failure", or "all" (the default).
+	Level string `yaml:"level"`
+}
+
+// EmailConfig sends an Event as a plaintext email over SMTP.
+type EmailConfig struct {
+	SMTPAddr string   `yaml:"smtp_addr"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// Level is one of "success", "failure", or "all" (the default).
+	Level string `yaml:"level"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	for _, w := range c.Webhooks {
+		if w.URL == "" {
+			return errors.New("every webhook notifier must include a url")
+		}
+		if err := validateLevel(w.Level); err != nil {
+			return err
+		}
+	}
+
+	if c.Email != nil {
+		if c.Email.SMTPAddr == "" || c.Email.From == "" || len(c.Email.To) == 0 {
+			return errors.New("the email notifier must include smtp_addr, from, and to")
+		}
+		if err := validateLevel(c.Email.Level); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range c.Services {
+		if _, err := parseServiceURL(s.URL); err != nil {
+			return fmt.Errorf("invalid service notifier: %v", err)
+		}
+		if err := validateLevel(s.Level); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateLevel(l string) error {
+	switch level(l) {
+	case "", levelAll, levelSuccess, levelFailure:
+		return nil
+	default:
+		return fmt.Errorf("invalid notification level %q: must be success, failure, or all", l)
+	}
+}
+
+// BackendResult is the outcome of uploading a backup to a single storage
+// backend, included in an Event so notifiers can report per-destination
+// status.
+type BackendResult struct {
+	Backend string `json:"backend"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Event describes the outcome of a single backup run.
+type Event struct {
+	// Version identifies the Todoist backup that was (or failed to be)
+	// backed up, e.g. "2018-07-13 02:06".
+	Version  string          `json:"version"`
+	Size     int64           `json:"size_bytes"`
+	Duration time.Duration   `json:"duration"`
+	Backends []BackendResult `json:"backends"`
+	// Error is the overall error for the run, or empty on success.
+	Error string `json:"error,omitempty"`
+}
+
+// outcome returns the level a notifier should match this event against.
+func (e Event) outcome() level {
+	if e.Error == "" {
+		return levelSuccess
+	}
+	return levelFailure
+}
+
+// matches reports whether a notifier configured with l should fire for e.
+func (e Event) matches(l string) bool {
+	return level(l) == "" || level(l) == levelAll || level(l) == e.outcome()
+}
+
+// Notify sends e to every notifier in c whose level matches e's outcome. It
+// returns a single error aggregating every notifier's failure, so that one
+// broken notifier doesn't prevent the others from firing.
+func Notify(ctx context.Context, c Config, e Event) error {
+	var msgs []string
+
+	for _, w := range c.Webhooks {
+		if !e.matches(w.Level) {
+			continue
+		}
+		if err := sendWebhook(ctx, w, e); err != nil {
+			msgs = append(msgs, fmt.Sprintf("webhook %v: %v", w.URL, err))
+		}
+	}
+
+	if c.Email != nil && e.matches(c.Email.Level) {
+		if err := sendEmail(*c.Email, e); err != nil {
+			msgs = append(msgs, fmt.Sprintf("email: %v", err))
+		}
+	}
+
+	for _, s := range c.Services {
+		if !e.matches(s.Level) {
+			continue
+		}
+		if err := sendService(ctx, s, e); err != nil {
+			msgs = append(msgs, fmt.Sprintf("service %v: %v", s.URL, err))
+		}
+	}
+
+	if len(msgs) > 0 {
+		return fmt.Errorf("%v notifications failed: %v", len(msgs), strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+func sendWebhook(ctx context.Context, w WebhookConfig, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("unable to encode the event: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got unexpected response code %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func sendEmail(c EmailConfig, e Event) error {
+	var auth smtp.Auth
+	if c.Username != "" {
+		host := c.SMTPAddr
+		if i := strings.LastIndex(host, ":"); i != -1 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", c.Username, c.Password, host)
+	}
+
+	subject := fmt.Sprintf("Todoist backup %v: %v", e.outcome(), e.Version)
+	msg := fmt.Sprintf("Subject: %v\r\n\r\n%v\r\n", subject, formatEventBody(e))
+
+	return smtp.SendMail(c.SMTPAddr, auth, c.From, c.To, []byte(msg))
+}
+
+func formatEventBody(e Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Version: %v\n", e.Version)
+	fmt.Fprintf(&b, "Duration: %v\n", e.Duration)
+	fmt.Fprintf(&b, "Size: %v bytes\n", e.Size)
+	if e.Error != "" {
+		fmt.Fprintf(&b, "Error: %v\n", e.Error)
+	}
+	for _, br := range e.Backends {
+		if br.Error == "" {
+			fmt.Fprintf(&b, "  %v: ok\n", br.Backend)
+		} else {
+			fmt.Fprintf(&b, "  %v: %v\n", br.Backend, br.Error)
+		}
+	}
+	return b.String()
+}
+
+// parseServiceURL checks that raw is a supported shoutrrr-style service URL
+// and returns its parsed form.
+func parseServiceURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %q: %v", raw, err)
+	}
+
+	switch u.Scheme {
+	case "slack":
+		if len(pathSegments(u)) != 3 {
+			return nil, fmt.Errorf("%q: expected slack://token-a/token-b/token-c", raw)
+		}
+	case "discord":
+		if len(pathSegments(u)) != 2 {
+			return nil, fmt.Errorf("%q: expected discord://webhook-id/webhook-token", raw)
+		}
+	case "telegram":
+		if u.User == nil || u.User.Username() == "" || u.Query().Get("chats") == "" {
+			return nil, fmt.Errorf("%q: expected telegram://bot-token@telegram?chats=chat-id", raw)
+		}
+	default:
+		return nil, fmt.Errorf("%q: unsupported service scheme %q (must be slack, discord, or telegram)", raw, u.Scheme)
+	}
+
+	return u, nil
+}
+
+// pathSegments returns the non-empty segments of u.Host and u.Path
+// together, since a shoutrrr-style service URL splits its token across
+// both (e.g. slack://token-a/token-b/token-c parses with Host=token-a).
+func pathSegments(u *url.URL) []string {
+	var segs []string
+	if u.Host != "" {
+		segs = append(segs, u.Host)
+	}
+	for _, s := range strings.Split(u.Path, "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// sendService posts e, formatted as a short text summary, to the chat
+// service addressed by s.URL.
+func sendService(ctx context.Context, s ServiceConfig, e Event) error {
+	u, err := parseServiceURL(s.URL)
+	if err != nil {
+		return err
+	}
+	text := serviceSummary(e)
+
+	switch u.Scheme {
+	case "slack":
+		hookURL := "https://hooks.slack.com/services/" + strings.Join(pathSegments(u), "/")
+		return postJSON(ctx, hookURL, map[string]string{"text": text})
+	case "discord":
+		segs := pathSegments(u)
+		hookURL := fmt.Sprintf("https://discord.com/api/webhooks/%v/%v", segs[0], segs[1])
+		return postJSON(ctx, hookURL, map[string]string{"content": text})
+	case "telegram":
+		token := u.User.Username()
+		if secret, ok := u.User.Password(); ok {
+			// A bot token of the form "id:secret" is parsed as a username
+			// and password, so join the two halves back together.
+			token += ":" + secret
+		}
+		for _, chatID := range strings.Split(u.Query().Get("chats"), ",") {
+			sendURL := fmt.Sprintf("https://api.telegram.org/bot%v/sendMessage", token)
+			if err := postJSON(ctx, sendURL, map[string]string{"chat_id": chatID, "text": text}); err != nil {
+				return fmt.Errorf("chat %v: %v", chatID, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported service scheme %q", u.Scheme)
+	}
+}
+
+// serviceSummary renders e as a short, single-message summary suitable for
+// a chat notification.
+func serviceSummary(e Event) string {
+	if e.Error != "" {
+		return fmt.Sprintf("Todoist backup %v failed: %v", e.Version, e.Error)
+	}
+	return fmt.Sprintf("Todoist backup %v succeeded (%v, %v bytes)", e.Version, e.Duration, e.Size)
+}
+
+// postJSON POSTs body, JSON-encoded, to destURL and treats any response
+// with a status of 300 or above as an error.
+func postJSON(ctx context.Context, destURL string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("unable to encode the request body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", destURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got unexpected response code %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// BackendResultsFrom converts storage.Results into BackendResults for use
+// in an Event.
+func BackendResultsFrom(results []storage.Result) []BackendResult {
+	brs := make([]BackendResult, 0, len(results))
+	for _, r := range results {
+		br := BackendResult{Backend: r.Backend}
+		if r.Err != nil {
+			br.Error = r.Err.Error()
+		}
+		brs = append(brs, br)
+	}
+	return brs
+}
@@ -0,0 +1,168 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid webhook",
+			conf:        Config{Webhooks: []WebhookConfig{{URL: "https://example.com/hook"}}},
+			errSubstr:   "",
+		},
+		{
+			description: "webhook missing url",
+			conf:        Config{Webhooks: []WebhookConfig{{Level: "failure"}}},
+			errSubstr:   "url",
+		},
+		{
+			description: "invalid level",
+			conf:        Config{Webhooks: []WebhookConfig{{URL: "https://example.com/hook", Level: "sometimes"}}},
+			errSubstr:   "invalid notification level",
+		},
+		{
+			description: "email missing fields",
+			conf:        Config{Email: &EmailConfig{SMTPAddr: "smtp.example.com:587"}},
+			errSubstr:   "smtp_addr, from, and to",
+		},
+		{
+			description: "valid email",
+			conf: Config{Email: &EmailConfig{
+				SMTPAddr: "smtp.example.com:587",
+				From:     "backups@example.com",
+				To:       []string{"me@example.com"},
+			}},
+			errSubstr: "",
+		},
+		{
+			description: "valid slack service",
+			conf:        Config{Services: []ServiceConfig{{URL: "slack://token-a/token-b/token-c"}}},
+			errSubstr:   "",
+		},
+		{
+			description: "valid discord service",
+			conf:        Config{Services: []ServiceConfig{{URL: "discord://webhook-id/webhook-token"}}},
+			errSubstr:   "",
+		},
+		{
+			description: "valid telegram service",
+			conf:        Config{Services: []ServiceConfig{{URL: "telegram://bot-token@telegram?chats=123"}}},
+			errSubstr:   "",
+		},
+		{
+			description: "unsupported service scheme",
+			conf:        Config{Services: []ServiceConfig{{URL: "teams://webhook"}}},
+			errSubstr:   "unsupported service scheme",
+		},
+		{
+			description: "malformed slack service url",
+			conf:        Config{Services: []ServiceConfig{{URL: "slack://token-a/token-b"}}},
+			errSubstr:   "expected slack://",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestEventMatches(t *testing.T) {
+	cases := []struct {
+		description string
+		event       Event
+		level       string
+		want        bool
+	}{
+		{
+			description: "success event, unset level matches",
+			event:       Event{},
+			level:       "",
+			want:        true,
+		},
+		{
+			description: "success event, all level matches",
+			event:       Event{},
+			level:       "all",
+			want:        true,
+		},
+		{
+			description: "success event, failure level doesn't match",
+			event:       Event{},
+			level:       "failure",
+			want:        false,
+		},
+		{
+			description: "failure event, failure level matches",
+			event:       Event{Error: "boom"},
+			level:       "failure",
+			want:        true,
+		},
+		{
+			description: "failure event, success level doesn't match",
+			event:       Event{Error: "boom"},
+			level:       "success",
+			want:        false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			if got := tc.event.matches(tc.level); got != tc.want {
+				t.Fatalf("expected matches(%q) to be %v but got %v", tc.level, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	var gotBody map[string]string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotBody)
+	}))
+	defer srv.Close()
+
+	err := postJSON(context.Background(), srv.URL, map[string]string{"text": "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotBody["text"] != "hello" {
+		t.Fatalf("expected the server to receive {\"text\": \"hello\"}, got %v", gotBody)
+	}
+}
+
+func TestPostJSONNonSuccessStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := postJSON(context.Background(), srv.URL, map[string]string{}); err == nil {
+		t.Fatal("expected an error from a 500 response")
+	}
+}
@@ -1,10 +1,192 @@
 package onedrive
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 )
 
+func TestNextRangeStart(t *testing.T) {
+	cases := []struct {
+		description        string
+		nextExpectedRanges []string
+		fallback           int
+		want               int
+		wantErr            bool
+	}{
+		{
+			description:        "no outstanding ranges",
+			nextExpectedRanges: nil,
+			fallback:           1048576,
+			want:               1048576,
+		},
+		{
+			description:        "a single open-ended range",
+			nextExpectedRanges: []string{"1048576-"},
+			fallback:           0,
+			want:               1048576,
+		},
+		{
+			description:        "a bounded range",
+			nextExpectedRanges: []string{"2097152-3145727"},
+			fallback:           0,
+			want:               2097152,
+		},
+		{
+			description:        "unparseable range",
+			nextExpectedRanges: []string{"not-a-number"},
+			fallback:           0,
+			wantErr:            true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := nextRangeStart(tc.nextExpectedRanges, tc.fallback)
+
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error status of %v but got %v with error %v", tc.wantErr, err != nil, err)
+			}
+
+			if err == nil && got != tc.want {
+				t.Fatalf("expected next range start %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// withFastGraphRetries temporarily swaps graphRetryConfig for a config with
+// no retries, so tests that want a single failed request to surface as an
+// error immediately don't have to wait out the package's real backoff.
+func withFastGraphRetries(t *testing.T) {
+	t.Helper()
+	orig := graphRetryConfig
+	graphRetryConfig.MaxRetries = 0
+	t.Cleanup(func() { graphRetryConfig = orig })
+}
+
+func TestUploadFragmentsMultiFragment(t *testing.T) {
+	withFastGraphRetries(t)
+
+	body := []byte("abcdefghijkl") // 12 bytes, split into fragments of 5
+	const fragmentBytes = 5
+
+	var mu sync.Mutex
+	var gotRanges []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotRanges = append(gotRanges, r.Header.Get("Content-Range"))
+		mu.Unlock()
+
+		io.ReadAll(r.Body)
+		if r.Header.Get("Content-Range") == fmt.Sprintf("bytes %v-%v/%v", len(body)-2, len(body)-1, len(body)) {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer srv.Close()
+
+	b := &Backend{}
+	if err := b.uploadFragments(context.Background(), srv.URL, body, fragmentBytes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"bytes 0-4/12", "bytes 5-9/12", "bytes 10-11/12"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(gotRanges) != len(want) {
+		t.Fatalf("expected %v fragment requests, got %v: %v", len(want), len(gotRanges), gotRanges)
+	}
+	for i, r := range want {
+		if gotRanges[i] != r {
+			t.Fatalf("fragment %v: expected Content-Range %q, got %q", i, r, gotRanges[i])
+		}
+	}
+}
+
+func TestUploadFragmentsResumesAfterFragmentError(t *testing.T) {
+	withFastGraphRetries(t)
+
+	body := []byte("abcdefgh") // 8 bytes, split into fragments of 4
+	const fragmentBytes = 4
+
+	var mu sync.Mutex
+	var puts []string
+	failedFirstFragment := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			// The session reports that it already has the bytes from the
+			// fragment the client saw as failed, so the client should
+			// resume from where the server actually left off rather than
+			// resending it.
+			fmt.Fprintf(w, `{"nextExpectedRanges": ["4-"]}`)
+			return
+		}
+
+		mu.Lock()
+		puts = append(puts, r.Header.Get("Content-Range"))
+		mu.Unlock()
+
+		if r.Header.Get("Content-Range") == "bytes 0-3/8" && !failedFirstFragment {
+			failedFirstFragment = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	b := &Backend{}
+	if err := b.uploadFragments(context.Background(), srv.URL, body, fragmentBytes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"bytes 0-3/8", "bytes 4-7/8"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(puts) != len(want) {
+		t.Fatalf("expected PUT requests %v, got %v", want, puts)
+	}
+	for i, r := range want {
+		if puts[i] != r {
+			t.Fatalf("request %v: expected Content-Range %q, got %q", i, r, puts[i])
+		}
+	}
+}
+
+func TestUploadFragmentsAbortsWhenSessionReportsNoProgress(t *testing.T) {
+	withFastGraphRetries(t)
+
+	body := []byte("abcdefgh")
+	const fragmentBytes = 4
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			// No progress is ever reported, so the client should give up
+			// after the first fragment fails rather than resending it.
+			fmt.Fprintf(w, `{"nextExpectedRanges": ["0-"]}`)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	b := &Backend{}
+	err := b.uploadFragments(context.Background(), srv.URL, body, fragmentBytes)
+	if err == nil {
+		t.Fatal("expected an error once the upload session reports no progress")
+	}
+}
+
 func TestConfigValidate(t *testing.T) {
 	cases := []struct {
 		description string
@@ -0,0 +1,134 @@
+// Package retention prunes old Todoist backups from a storage.Backend so
+// that it doesn't grow unbounded. Prune is called once per backend after
+// each successful upload.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ptgott/todoist-backups/storage"
+	"github.com/ptgott/todoist-backups/todoist"
+)
+
+// Config controls how many backups to keep, bucketed by period. A backup
+// is kept if it falls into any bucket, so the buckets are additive rather
+// than exclusive.
+type Config struct {
+	// KeepLast keeps the N most recent backups, regardless of age.
+	KeepLast int `yaml:"keep_last"`
+	// KeepDaily keeps the most recent backup from each of the last N days
+	// that have a backup.
+	KeepDaily int `yaml:"keep_daily"`
+	// KeepWeekly keeps the most recent backup from each of the last N weeks
+	// that have a backup.
+	KeepWeekly int `yaml:"keep_weekly"`
+	// KeepMonthly keeps the most recent backup from each of the last N
+	// months that have a backup.
+	KeepMonthly int `yaml:"keep_monthly"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.KeepLast < 0 || c.KeepDaily < 0 || c.KeepWeekly < 0 || c.KeepMonthly < 0 {
+		return errors.New("retention counts must not be negative")
+	}
+
+	if c.KeepLast == 0 && c.KeepDaily == 0 && c.KeepWeekly == 0 && c.KeepMonthly == 0 {
+		return errors.New("must set at least one of keep_last, keep_daily, keep_weekly, or keep_monthly")
+	}
+
+	return nil
+}
+
+// backup pairs a storage.BackupObject with the version timestamp recovered
+// from its filename.
+type backup struct {
+	name    string
+	version time.Time
+}
+
+// Prune lists every backup object at b and deletes the ones that don't
+// fall into any retention bucket configured by c. Objects whose name
+// doesn't parse as a backup filename (see todoist.ParseBackupVersion) are
+// left alone, since Prune can't tell whether they're safe to remove.
+func Prune(ctx context.Context, b storage.Backend, c Config) error {
+	objs, err := b.List(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list %v's backups: %v", b.String(), err)
+	}
+
+	var backups []backup
+	for _, o := range objs {
+		v, err := todoist.ParseBackupVersion(o.Name)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: o.Name, version: v})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].version.After(backups[j].version)
+	})
+
+	keep := make(map[string]bool)
+
+	for i, bk := range backups {
+		if i < c.KeepLast {
+			keep[bk.name] = true
+		}
+	}
+
+	keepBucketed(backups, c.KeepDaily, keep, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepBucketed(backups, c.KeepWeekly, keep, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%v-W%02d", year, week)
+	})
+	keepBucketed(backups, c.KeepMonthly, keep, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	var msgs []string
+	for _, bk := range backups {
+		if keep[bk.name] {
+			continue
+		}
+		if err := b.Delete(ctx, bk.name); err != nil {
+			msgs = append(msgs, fmt.Sprintf("unable to delete %v from %v: %v", bk.name, b.String(), err))
+		}
+	}
+
+	if len(msgs) > 0 {
+		return fmt.Errorf("pruning failed for %v backups: %v", len(msgs), strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+// keepBucketed marks the newest backup in each of the first n distinct
+// periods (as identified by bucketKey, applied to backups in
+// newest-first order) as kept.
+func keepBucketed(backups []backup, n int, keep map[string]bool, bucketKey func(time.Time) string) {
+	if n <= 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, bk := range backups {
+		if len(seen) >= n {
+			return
+		}
+		key := bucketKey(bk.version)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keep[bk.name] = true
+	}
+}
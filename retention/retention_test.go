@@ -0,0 +1,116 @@
+package retention
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ptgott/todoist-backups/storage"
+)
+
+// fakeBackend is an in-memory storage.Backend used to test Prune without a
+// real storage provider.
+type fakeBackend struct {
+	objects map[string]time.Time
+}
+
+func (f *fakeBackend) String() string { return "fake" }
+
+func (f *fakeBackend) Upload(ctx context.Context, name string, r io.Reader) error {
+	return nil
+}
+
+func (f *fakeBackend) List(ctx context.Context) ([]storage.BackupObject, error) {
+	var objs []storage.BackupObject
+	for name, t := range f.objects {
+		objs = append(objs, storage.BackupObject{Name: name, ModTime: t})
+	}
+	return objs, nil
+}
+
+func (f *fakeBackend) Delete(ctx context.Context, name string) error {
+	delete(f.objects, name)
+	return nil
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid config",
+			conf:        Config{KeepLast: 3},
+			errSubstr:   "",
+		},
+		{
+			description: "no buckets set",
+			conf:        Config{},
+			errSubstr:   "at least one",
+		},
+		{
+			description: "negative count",
+			conf:        Config{KeepLast: -1},
+			errSubstr:   "negative",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestPruneKeepLast(t *testing.T) {
+	f := &fakeBackend{objects: map[string]time.Time{}}
+	for _, v := range []string{
+		"2024-01-01 00:00",
+		"2024-01-02 00:00",
+		"2024-01-03 00:00",
+	} {
+		f.objects[v+".zip"] = time.Time{}
+	}
+
+	if err := Prune(context.Background(), f, Config{KeepLast: 1}); err != nil {
+		t.Fatalf("unexpected error from Prune: %v", err)
+	}
+
+	if len(f.objects) != 1 {
+		t.Fatalf("expected 1 remaining object but got %v", f.objects)
+	}
+	if _, ok := f.objects["2024-01-03 00:00.zip"]; !ok {
+		t.Fatalf("expected the most recent backup to survive, got %v", f.objects)
+	}
+}
+
+func TestPruneIgnoresUnparseableNames(t *testing.T) {
+	f := &fakeBackend{objects: map[string]time.Time{
+		"2024-01-01 00:00.zip": {},
+		"README.md":             {},
+	}}
+
+	if err := Prune(context.Background(), f, Config{KeepLast: 0, KeepDaily: 1}); err != nil {
+		t.Fatalf("unexpected error from Prune: %v", err)
+	}
+
+	if _, ok := f.objects["README.md"]; !ok {
+		t.Fatalf("expected the non-backup object to be left alone, got %v", f.objects)
+	}
+}
@@ -0,0 +1,138 @@
+// Package s3 implements a storage.Backend that uploads, lists, and deletes
+// Todoist backups in an S3 (or S3-compatible) bucket, following the pattern
+// of tools like rclone and docker-volume-backup that treat S3 as a
+// first-class remote backup destination.
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/ptgott/todoist-backups/storage"
+)
+
+// Config contains options for the S3 backend.
+type Config struct {
+	// Bucket backups are uploaded to. Must already exist.
+	Bucket string `yaml:"bucket"`
+	// Prefix is prepended to every object key, e.g. "todoist-backups/".
+	Prefix string `yaml:"prefix"`
+	// Region the bucket lives in.
+	Region string `yaml:"region"`
+	// AccessKeyID and SecretAccessKey authenticate against S3. If either is
+	// empty, the AWS SDK's default credential chain is used instead (env
+	// vars, shared config, an instance/task role), which is the preferred
+	// option outside of S3-compatible providers that require static keys.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// Endpoint overrides the default AWS endpoint, for S3-compatible
+	// providers like MinIO or Backblaze B2.
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.Bucket == "" {
+		return errors.New("must provide a bucket")
+	}
+	if c.Region == "" {
+		return errors.New("must provide a region")
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		return errors.New("access_key_id and secret_access_key must both be set, or both left empty to use the default AWS credential chain")
+	}
+	return nil
+}
+
+// Backend uploads, lists, and deletes Todoist backups in a single S3
+// bucket. It implements storage.Backend.
+type Backend struct {
+	svc    *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewBackend builds a Backend that authenticates against S3 using c.
+func NewBackend(ctx context.Context, c Config) (*Backend, error) {
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(c.Region)}
+	if c.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, ""),
+		))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load an AWS config: %v", err)
+	}
+
+	svc := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if c.Endpoint != "" {
+			o.BaseEndpoint = aws.String(c.Endpoint)
+		}
+	})
+
+	return &Backend{svc: svc, bucket: c.Bucket, prefix: c.Prefix}, nil
+}
+
+// String identifies this backend in log messages and aggregated errors.
+func (b *Backend) String() string {
+	return "s3"
+}
+
+// key returns the object key name is stored under, accounting for Prefix.
+func (b *Backend) key(name string) string {
+	return b.prefix + name
+}
+
+// Upload streams the contents of r to the configured bucket under name.
+func (b *Backend) Upload(ctx context.Context, name string, r io.Reader) error {
+	_, err := b.svc.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+		Body:   r,
+	})
+	return err
+}
+
+// List returns every backup object under Prefix in the configured bucket.
+func (b *Backend) List(ctx context.Context) ([]storage.BackupObject, error) {
+	var objs []storage.BackupObject
+
+	p := s3.NewListObjectsV2Paginator(b.svc, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(b.prefix),
+	})
+
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list objects in bucket %q: %v", b.bucket, err)
+		}
+
+		for _, obj := range page.Contents {
+			objs = append(objs, storage.BackupObject{
+				Name:    (*obj.Key)[len(b.prefix):],
+				ModTime: *obj.LastModified,
+			})
+		}
+	}
+
+	return objs, nil
+}
+
+// Delete removes the object named name from the configured bucket.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	_, err := b.svc.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	return err
+}
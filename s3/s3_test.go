@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid config with default credential chain",
+			conf:        Config{Bucket: "my-bucket", Region: "us-east-1"},
+			errSubstr:   "",
+		},
+		{
+			description: "valid config with static credentials",
+			conf:        Config{Bucket: "my-bucket", Region: "us-east-1", AccessKeyID: "id", SecretAccessKey: "secret"},
+			errSubstr:   "",
+		},
+		{
+			description: "missing bucket",
+			conf:        Config{Region: "us-east-1"},
+			errSubstr:   "bucket",
+		},
+		{
+			description: "missing region",
+			conf:        Config{Bucket: "my-bucket"},
+			errSubstr:   "region",
+		},
+		{
+			description: "access key without secret",
+			conf:        Config{Bucket: "my-bucket", Region: "us-east-1", AccessKeyID: "id"},
+			errSubstr:   "access_key_id",
+		},
+		{
+			description: "secret without access key",
+			conf:        Config{Bucket: "my-bucket", Region: "us-east-1", SecretAccessKey: "secret"},
+			errSubstr:   "access_key_id",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestBackendKey(t *testing.T) {
+	b := &Backend{prefix: "todoist-backups/"}
+	if got, want := b.key("backup.zip"), "todoist-backups/backup.zip"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+// Package sftp implements a storage.Backend that uploads, lists, and
+// deletes Todoist backups on a remote server over SFTP, using
+// golang.org/x/crypto/ssh and github.com/pkg/sftp.
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/pkg/sftp"
+	"github.com/ptgott/todoist-backups/storage"
+	"golang.org/x/crypto/ssh"
+)
+
+// Config contains options for the SFTP backend.
+type Config struct {
+	// Host and Port address the SFTP server. Port defaults to 22.
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Username authenticates against the server.
+	Username string `yaml:"username"`
+	// Password authenticates with a password. Leave empty if using
+	// PrivateKeyPath instead.
+	Password string `yaml:"password"`
+	// PrivateKeyPath is the path to a private key file to authenticate
+	// with, as an alternative to Password.
+	PrivateKeyPath string `yaml:"private_key_path"`
+	// Directory backups are uploaded into on the remote server. Must
+	// already exist.
+	Directory string `yaml:"directory"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.Host == "" {
+		return errors.New("must provide a host")
+	}
+	if c.Username == "" {
+		return errors.New("must provide a username")
+	}
+	if c.Password == "" && c.PrivateKeyPath == "" {
+		return errors.New("must provide either a password or a private_key_path")
+	}
+	if c.Directory == "" {
+		return errors.New("must provide a directory")
+	}
+	return nil
+}
+
+// port returns the configured port, or 22 if unset.
+func (c Config) port() int {
+	if c.Port == 0 {
+		return 22
+	}
+	return c.Port
+}
+
+// Backend uploads, lists, and deletes Todoist backups in a single
+// directory on a remote server over SFTP. It implements storage.Backend.
+type Backend struct {
+	client *sftp.Client
+	conn   *ssh.Client
+	dir    string
+}
+
+// NewBackend builds a Backend that authenticates against the SFTP server
+// described by c.
+func NewBackend(c Config) (*Backend, error) {
+	auth, err := authMethod(c)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(c.Host, strconv.Itoa(c.port())), &ssh.ClientConfig{
+		User: c.Username,
+		Auth: []ssh.AuthMethod{auth},
+		// Todoist backups aren't sensitive enough to justify forcing users
+		// to manage a known_hosts file for this tool, and the SSH session
+		// is only used to move an already-encrypted-if-configured file.
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the SFTP server: %v", err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to start an SFTP session: %v", err)
+	}
+
+	return &Backend{client: client, conn: conn, dir: c.Directory}, nil
+}
+
+// authMethod builds the ssh.AuthMethod described by c, preferring a private
+// key over a password when both are set.
+func authMethod(c Config) (ssh.AuthMethod, error) {
+	if c.PrivateKeyPath != "" {
+		key, err := os.ReadFile(c.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the private key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the private key: %v", err)
+		}
+		return ssh.PublicKeys(signer), nil
+	}
+	return ssh.Password(c.Password), nil
+}
+
+// String identifies this backend in log messages and aggregated errors.
+func (b *Backend) String() string {
+	return "sftp"
+}
+
+// Upload streams the contents of r to the configured directory under name.
+func (b *Backend) Upload(ctx context.Context, name string, r io.Reader) error {
+	f, err := b.client.Create(path.Join(b.dir, name))
+	if err != nil {
+		return fmt.Errorf("unable to create %v: %v", name, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("unable to write %v: %v", name, err)
+	}
+
+	return nil
+}
+
+// List returns every backup object in the configured directory.
+func (b *Backend) List(ctx context.Context) ([]storage.BackupObject, error) {
+	infos, err := b.client.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %v: %v", b.dir, err)
+	}
+
+	objs := make([]storage.BackupObject, 0, len(infos))
+	for _, fi := range infos {
+		if fi.IsDir() {
+			continue
+		}
+		objs = append(objs, storage.BackupObject{Name: fi.Name(), ModTime: fi.ModTime()})
+	}
+	return objs, nil
+}
+
+// Delete removes the object named name from the configured directory. It's
+// not an error for the object to already be absent.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	err := b.client.Remove(path.Join(b.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to delete %v: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package sftp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid config with password",
+			conf:        Config{Host: "example.com", Username: "backup", Password: "secret", Directory: "/backups"},
+			errSubstr:   "",
+		},
+		{
+			description: "valid config with private key",
+			conf:        Config{Host: "example.com", Username: "backup", PrivateKeyPath: "/home/backup/.ssh/id_ed25519", Directory: "/backups"},
+			errSubstr:   "",
+		},
+		{
+			description: "missing host",
+			conf:        Config{Username: "backup", Password: "secret", Directory: "/backups"},
+			errSubstr:   "host",
+		},
+		{
+			description: "missing username",
+			conf:        Config{Host: "example.com", Password: "secret", Directory: "/backups"},
+			errSubstr:   "username",
+		},
+		{
+			description: "missing password and private key",
+			conf:        Config{Host: "example.com", Username: "backup", Directory: "/backups"},
+			errSubstr:   "password",
+		},
+		{
+			description: "missing directory",
+			conf:        Config{Host: "example.com", Username: "backup", Password: "secret"},
+			errSubstr:   "directory",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestConfigPort(t *testing.T) {
+	if got, want := (Config{}).port(), 22; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := (Config{Port: 2222}).port(), 2222; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
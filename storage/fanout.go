@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Result is the outcome of uploading a backup to a single Backend.
+type Result struct {
+	Backend string
+	Err     error
+}
+
+// UploadAll fans r out to every backend in parallel via an io.Pipe per
+// backend, so that the backup is never buffered in full: each backend
+// reads its copy as r is read, rather than from a shared in-memory buffer.
+// One slow or failing destination doesn't abort the others, though writing
+// to r is paced by the slowest backend still reading, since every backend
+// must receive the same bytes. It returns a Result per backend, in the
+// same order as backends, plus a single error aggregating every backend's
+// failure (or nil if all uploads succeeded).
+func UploadAll(ctx context.Context, backends []Backend, name string, r io.Reader) ([]Result, error) {
+	if len(backends) == 0 {
+		return nil, nil
+	}
+
+	results := make([]Result, len(backends))
+	writers := make([]io.Writer, len(backends))
+	pipes := make([]*io.PipeWriter, len(backends))
+
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		pipes[i] = pw
+
+		wg.Add(1)
+		go func(i int, b Backend, pr *io.PipeReader) {
+			defer wg.Done()
+			err := b.Upload(ctx, name, pr)
+			// Drain any bytes Upload left unread so a backend that returns
+			// early (e.g. on an error) doesn't block the fan-out below,
+			// which writes to every backend's pipe in lockstep.
+			io.Copy(io.Discard, pr)
+			results[i] = Result{Backend: b.String(), Err: err}
+		}(i, b, pr)
+	}
+
+	_, copyErr := io.Copy(io.MultiWriter(writers...), r)
+	for _, pw := range pipes {
+		pw.CloseWithError(copyErr)
+	}
+	wg.Wait()
+
+	var msgs []string
+	for _, res := range results {
+		if res.Err != nil {
+			msgs = append(msgs, fmt.Sprintf("%v: %v", res.Backend, res.Err))
+		}
+	}
+	if copyErr != nil {
+		msgs = append(msgs, fmt.Sprintf("reading the backup: %v", copyErr))
+	}
+
+	if len(msgs) > 0 {
+		return results, fmt.Errorf("upload failed for %v of %v backends: %v", len(msgs), len(backends), strings.Join(msgs, "; "))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type fakeBackend struct {
+	name string
+	// failAfter, if >= 0, makes Upload return a "boom" error after reading this
+	// many bytes instead of draining r to the end.
+	failAfter int
+	got       []byte
+}
+
+func (f *fakeBackend) String() string { return f.name }
+
+func (f *fakeBackend) Upload(ctx context.Context, name string, r io.Reader) error {
+	if f.failAfter < 0 {
+		got, err := io.ReadAll(r)
+		f.got = got
+		return err
+	}
+
+	got, _ := io.ReadAll(io.LimitReader(r, int64(f.failAfter)))
+	f.got = got
+	return errors.New("boom")
+}
+
+func (f *fakeBackend) List(ctx context.Context) ([]BackupObject, error) { return nil, nil }
+func (f *fakeBackend) Delete(ctx context.Context, name string) error    { return nil }
+
+func TestUploadAllSendsEveryByteToEveryBackend(t *testing.T) {
+	content := []byte(strings.Repeat("backup data ", 1000))
+
+	a := &fakeBackend{name: "a", failAfter: -1}
+	b := &fakeBackend{name: "b", failAfter: -1}
+
+	results, err := UploadAll(context.Background(), []Backend{a, b}, "backup.zip", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %v", len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("backend %v: unexpected error: %v", r.Backend, r.Err)
+		}
+	}
+	if !bytes.Equal(a.got, content) || !bytes.Equal(b.got, content) {
+		t.Fatal("expected both backends to receive the full content")
+	}
+}
+
+func TestUploadAllContinuesAfterOneBackendFails(t *testing.T) {
+	content := []byte(strings.Repeat("backup data ", 1000))
+
+	failing := &fakeBackend{name: "failing", failAfter: 10}
+	ok := &fakeBackend{name: "ok", failAfter: -1}
+
+	results, err := UploadAll(context.Background(), []Backend{failing, ok}, "backup.zip", bytes.NewReader(content))
+	if err == nil {
+		t.Fatal("expected an aggregate error since one backend failed")
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %v", len(results))
+	}
+
+	if !bytes.Equal(ok.got, content) {
+		t.Fatal("expected the healthy backend to still receive the full content")
+	}
+}
@@ -0,0 +1,40 @@
+// Package storage defines the interface that every Todoist backup
+// destination (Google Drive, OneDrive, local disk, and so on) must
+// implement. main.go holds a list of configured Backends and fans the same
+// backup out to each of them.
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// BackupObject describes a single backup that already exists at a Backend,
+// as returned by List. Name is the backend-specific identifier needed to
+// Delete the object again.
+type BackupObject struct {
+	Name    string
+	ModTime time.Time
+}
+
+// Backend is a destination that Todoist backups can be uploaded to. Each
+// storage package (gdrive, onedrive, localfs, ...) provides a type that
+// implements Backend.
+type Backend interface {
+	// Upload sends the contents of r to the backend under name. It must not
+	// return until the content has been durably written.
+	Upload(ctx context.Context, name string, r io.Reader) error
+
+	// List returns every backup object currently stored at the backend, in
+	// no particular order, so that callers can apply a retention policy.
+	List(ctx context.Context) ([]BackupObject, error)
+
+	// Delete removes the object with the given name from the backend. It
+	// must not return an error if the object is already absent.
+	Delete(ctx context.Context, name string) error
+
+	// String returns a short, human-readable identifier for the backend
+	// (e.g. "google_drive"), used in log messages and error aggregation.
+	String() string
+}
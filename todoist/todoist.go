@@ -1,14 +1,17 @@
 package todoist
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ptgott/todoist-backups/apiclient"
+	"github.com/ptgott/todoist-backups/encryption"
 )
 
 type AvailableBackups []AvailableBackup
@@ -28,11 +31,44 @@ const todoistBackupURL = "https://api.todoist.com/sync/v9/backups/get"
 // https://developer.todoist.com/sync/v8/#get-backups
 const todoistTimeFormat = "2006-01-02 15:04"
 
+// backupExtension is appended to a backup's version to build the filename
+// it's uploaded under.
+const backupExtension = ".zip"
+
+// BackupFilename returns the filename a backup with the given version
+// should be uploaded under.
+func BackupFilename(version string) string {
+	return version + backupExtension
+}
+
+// ParseBackupVersion recovers a backup's version timestamp from a filename
+// produced by BackupFilename, optionally followed by encryption.Extension
+// if the backup was encrypted before upload. Some storage backends (e.g.
+// onedrive) replace characters like ":" that aren't valid in their
+// filenames, so this also tries the ":"-restored form of the timestamp
+// before giving up.
+func ParseBackupVersion(filename string) (time.Time, error) {
+	v := strings.TrimSuffix(filename, encryption.Extension)
+	v = strings.TrimSuffix(v, backupExtension)
+
+	if t, err := time.Parse(todoistTimeFormat, v); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(todoistTimeFormat, strings.ReplaceAll(v, "_", ":"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse a backup version from filename %q: %v", filename, err)
+	}
+
+	return t, nil
+}
+
 // GetAvailableBackups queries Todoist's sync API path for listing backups.
 // It handles retries and returns an error either for a client issue or when
 // all possibilities for retrieving available backups have been exhausted.
-func GetAvailableBackups(token string) (AvailableBackups, error) {
-	tr, err := http.NewRequest("GET", todoistBackupURL, nil)
+// Canceling ctx aborts an in-flight request or retry sleep.
+func GetAvailableBackups(ctx context.Context, token string) (AvailableBackups, error) {
+	tr, err := http.NewRequestWithContext(ctx, "GET", todoistBackupURL, nil)
 
 	if err != nil {
 		return AvailableBackups{},
@@ -44,8 +80,9 @@ func GetAvailableBackups(token string) (AvailableBackups, error) {
 		http.DefaultClient,
 		tr,
 		apiclient.RetryConfig{
-			IntervalBetweenRetries: time.Duration(10) * time.Minute,
-			MaxRetries:             6,
+			BaseDelay:  time.Second,
+			MaxDelay:   time.Duration(10) * time.Minute,
+			MaxRetries: 6,
 		})
 
 	if err != nil {
@@ -69,9 +106,10 @@ func GetAvailableBackups(token string) (AvailableBackups, error) {
 // GetBackup sends a GET request to the Todoist backup URL given in url with
 // the provided bearer token. It writes the downloaded ZIP payload to w.
 // Non-200 error codes will be returned as errors. If the payload reaches
-// maxBytes in size, GetBackup will return an error.
-func GetBackup(w io.Writer, token string, url string, maxBytes int64) error {
-	tr, err := http.NewRequest("GET", url, nil)
+// maxBytes in size, GetBackup will return an error. Canceling ctx aborts
+// an in-flight request or retry sleep.
+func GetBackup(ctx context.Context, w io.Writer, token string, url string, maxBytes int64) error {
+	tr, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 
 	if err != nil {
 		return fmt.Errorf("unable to generate an HTTP request to %v:%v", url, err)
@@ -82,8 +120,9 @@ func GetBackup(w io.Writer, token string, url string, maxBytes int64) error {
 		http.DefaultClient,
 		tr,
 		apiclient.RetryConfig{
-			IntervalBetweenRetries: time.Duration(10) * time.Minute,
-			MaxRetries:             6,
+			BaseDelay:  time.Second,
+			MaxDelay:   time.Duration(10) * time.Minute,
+			MaxRetries: 6,
 		})
 
 	if err != nil {
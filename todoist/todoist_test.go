@@ -1,6 +1,55 @@
 package todoist
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBackupVersion(t *testing.T) {
+	want := time.Date(2018, 7, 13, 2, 6, 0, 0, time.UTC)
+
+	cases := []struct {
+		description string
+		filename    string
+		wantErr     bool
+	}{
+		{
+			description: "unmodified filename",
+			filename:    "2018-07-13 02:06.zip",
+		},
+		{
+			description: "colons replaced with underscores, as onedrive does",
+			filename:    "2018-07-13 02_06.zip",
+		},
+		{
+			description: "encrypted backup",
+			filename:    "2018-07-13 02:06.zip.enc",
+		},
+		{
+			description: "encrypted backup with colons replaced",
+			filename:    "2018-07-13 02_06.zip.enc",
+		},
+		{
+			description: "not a valid backup filename",
+			filename:    "not-a-backup.zip",
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := ParseBackupVersion(tc.filename)
+
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error status of %v but got %v with error %v", tc.wantErr, err != nil, err)
+			}
+
+			if err == nil && !got.Equal(want) {
+				t.Fatalf("expected version %v but got %v", want, got)
+			}
+		})
+	}
+}
 
 func TestLatestAvailableBackup(t *testing.T) {
 	cases := []struct {
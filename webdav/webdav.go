@@ -0,0 +1,94 @@
+// Package webdav implements a storage.Backend that uploads, lists, and
+// deletes Todoist backups on any WebDAV server (Nextcloud, ownCloud,
+// Apache mod_dav, etc.), using github.com/studio-b12/gowebdav as the
+// client.
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ptgott/todoist-backups/storage"
+	"github.com/studio-b12/gowebdav"
+)
+
+// Config contains options for the WebDAV backend.
+type Config struct {
+	// URL is the base address of the WebDAV server, including any path to
+	// the directory backups should be written into, e.g.
+	// "https://example.com/remote.php/dav/files/user/backups".
+	URL string `yaml:"url"`
+	// Username and Password authenticate against the server using HTTP
+	// Basic auth, as gowebdav does. Leave both empty for an
+	// unauthenticated server.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Validate checks the Config for errors and returns the first one it finds.
+func (c Config) Validate() error {
+	if c.URL == "" {
+		return errors.New("must provide a url")
+	}
+	return nil
+}
+
+// Backend uploads, lists, and deletes Todoist backups in a single
+// directory on a WebDAV server. It implements storage.Backend.
+type Backend struct {
+	client *gowebdav.Client
+}
+
+// NewBackend builds a Backend that authenticates against the WebDAV server
+// described by c.
+func NewBackend(c Config) (*Backend, error) {
+	client := gowebdav.NewClient(c.URL, c.Username, c.Password)
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("unable to connect to the WebDAV server: %v", err)
+	}
+	return &Backend{client: client}, nil
+}
+
+// String identifies this backend in log messages and aggregated errors.
+func (b *Backend) String() string {
+	return "webdav"
+}
+
+// Upload streams the contents of r to the configured directory under name.
+func (b *Backend) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.client.WriteStream(name, r, 0644); err != nil {
+		return fmt.Errorf("unable to upload %v: %v", name, err)
+	}
+	return nil
+}
+
+// List returns every backup object in the configured directory.
+func (b *Backend) List(ctx context.Context) ([]storage.BackupObject, error) {
+	infos, err := b.client.ReadDir("")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the WebDAV directory: %v", err)
+	}
+
+	objs := make([]storage.BackupObject, 0, len(infos))
+	for _, fi := range infos {
+		if fi.IsDir() {
+			continue
+		}
+		objs = append(objs, storage.BackupObject{Name: fi.Name(), ModTime: fi.ModTime()})
+	}
+	return objs, nil
+}
+
+// Delete removes the object named name from the configured directory.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if err := b.client.Remove(name); err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return nil
+		}
+		return fmt.Errorf("unable to delete %v: %v", name, err)
+	}
+	return nil
+}
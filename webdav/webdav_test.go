@@ -0,0 +1,44 @@
+package webdav
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		description string
+		conf        Config
+		errSubstr   string
+	}{
+		{
+			description: "valid config",
+			conf:        Config{URL: "https://example.com/remote.php/dav/files/user/backups"},
+			errSubstr:   "",
+		},
+		{
+			description: "missing url",
+			conf:        Config{},
+			errSubstr:   "url",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.conf.Validate()
+
+			if err != nil && tc.errSubstr == "" {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err == nil && tc.errSubstr != "" {
+				t.Fatal("expected an error but got nil")
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tc.errSubstr) {
+				t.Fatalf("could not find expected substring %q in error message %q", tc.errSubstr, err.Error())
+			}
+		})
+	}
+}